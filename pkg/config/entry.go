@@ -1,5 +1,12 @@
 package config
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
 // Entry is a type that allows the config package to access configuration
 // values.
 type Entry struct {
@@ -9,6 +16,42 @@ type Entry struct {
 	EnvKey       string // the environment variables that holds the value
 }
 
+// Value returns the entry value stored in [viper]. If no source provided a
+// value, including when the entry was not given to [NewConfig], the default
+// value is returned.
+func (e Entry) Value() string {
+	if !viper.IsSet(e.Flag) {
+		return e.DefaultValue
+	}
+
+	return viper.GetString(e.Flag)
+}
+
+// Values returns the entry value as a list. The value can either be a list
+// in the config file, or a comma-separated string from any source. Blank
+// items are ignored.
+func (e Entry) Values() []string {
+	var items []string
+	if !viper.IsSet(e.Flag) {
+		items = strings.Split(e.DefaultValue, ",")
+	} else if list, ok := viper.Get(e.Flag).([]any); ok {
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+	} else {
+		items = strings.Split(viper.GetString(e.Flag), ",")
+	}
+
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
 // The fields for the config entry.
 const (
 	ConfigFlag         = "config"
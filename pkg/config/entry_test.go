@@ -0,0 +1,71 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryValue_withDefault(t *testing.T) {
+	// given
+	viper.Reset()
+	entryGiven := config.Entry{
+		Flag:         "entry-unset",
+		DefaultValue: "default",
+	}
+
+	// when
+	valueActual := entryGiven.Value()
+
+	// then
+	assert.Equal(t, "default", valueActual)
+}
+
+func TestEntryValue_withValue(t *testing.T) {
+	// given
+	viper.Reset()
+	entryGiven := config.Entry{
+		Flag:         "entry-set",
+		DefaultValue: "default",
+	}
+	viper.Set(entryGiven.Flag, "")
+
+	// when
+	valueActual := entryGiven.Value()
+
+	// then
+	assert.Equal(t, "", valueActual)
+}
+
+func TestEntryValues(t *testing.T) {
+	testCases := map[string]struct {
+		value    any
+		expected []string
+	}{
+		"unset":  {nil, []string{"a", "b"}},
+		"string": {" c, d ,, ", []string{"c", "d"}},
+		"list":   {[]any{"e", 1}, []string{"e", "1"}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// given
+			viper.Reset()
+			entryGiven := config.Entry{
+				Flag:         "entry-list",
+				DefaultValue: "a,b",
+			}
+			if tc.value != nil {
+				viper.Set(entryGiven.Flag, tc.value)
+			}
+
+			// when
+			valuesActual := entryGiven.Values()
+
+			// then
+			assert.Equal(t, tc.expected, valuesActual)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// accessLog logs one entry per request, in the Cloud Logging httpRequest
+// format.
+type accessLog struct {
+	logger     *slog.Logger    // the structured logger
+	sampleRate float64         // the ratio of requests logged
+	exclude    map[string]bool // the paths never logged
+}
+
+// newAccessLog creates the access log from the config entries.
+func newAccessLog() (*accessLog, error) {
+	value := AccessLogSampleRateEntry.Value()
+	sampleRate, err := strconv.ParseFloat(value, 64)
+	if err != nil || sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("invalid %s value %q",
+			AccessLogSampleRateEntry.Flag, value)
+	}
+
+	exclude := make(map[string]bool)
+	for _, path := range AccessLogExcludeEntry.Values() {
+		exclude[path] = true
+	}
+
+	return &accessLog{
+		sampleRate: sampleRate,
+		exclude:    exclude,
+	}, nil
+}
+
+// middleware logs the requests once served. The server errors are always
+// logged, the other requests are sampled.
+func (a *accessLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if a.exclude[req.URL.Path] {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		start := time.Now()
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, req)
+		latency := time.Since(start)
+
+		if !a.sampled(rw.status >= http.StatusInternalServerError) {
+			return
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case rw.status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case rw.status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		a.logger.LogAttrs(req.Context(), level,
+			fmt.Sprintf("%s %s %d", req.Method, req.URL.Path, rw.status),
+			httpRequestAttr(req, rw, latency))
+	})
+}
+
+// sampled says if a request that is not excluded must be logged. The server
+// errors are always logged.
+func (a *accessLog) sampled(serverError bool) bool {
+	return serverError || rand.Float64() < a.sampleRate
+}
+
+// httpRequestAttr creates the Cloud Logging httpRequest attribute.
+func httpRequestAttr(
+	req *http.Request, rw *responseWriter, latency time.Duration) slog.Attr {
+
+	attrs := []any{
+		slog.String("requestMethod", req.Method),
+		slog.String("requestUrl", req.URL.String()),
+		slog.Int("status", rw.status),
+		slog.String("responseSize", strconv.FormatInt(rw.size, 10)),
+		slog.String("userAgent", req.UserAgent()),
+		slog.String("remoteIp", clientIP(req)),
+		slog.String("protocol", req.Proto),
+		slog.String("latency", strconv.FormatFloat(latency.Seconds(), 'f', -1, 64)+"s"),
+	}
+
+	if req.ContentLength >= 0 {
+		attrs = append(attrs, slog.String("requestSize",
+			strconv.FormatInt(req.ContentLength, 10)))
+	}
+
+	if referer := req.Referer(); referer != "" {
+		attrs = append(attrs, slog.String("referer", referer))
+	}
+
+	return slog.Group("httpRequest", attrs...)
+}
@@ -0,0 +1,101 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// handleCreated registers a "/" route answering 201 with a body, and a
+// "/fail" route answering 502.
+func handleCreated(s *server.Server) {
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	})
+	handleStatus(s, "/fail", http.StatusBadGateway)
+}
+
+func TestAccessLog(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(&output))
+	assert.Nil(t, err)
+	handleCreated(s)
+
+	// when
+	req := httptest.NewRequest(http.MethodPost, "/?q=1", nil)
+	req.Header.Set("User-Agent", "agent-given")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	// then
+	assert.Contains(t, output.String(), `msg="POST / 201"`)
+	assert.Contains(t, output.String(), "httpRequest.requestMethod=POST")
+	assert.Contains(t, output.String(), `httpRequest.requestUrl="/?q=1"`)
+	assert.Contains(t, output.String(), "httpRequest.status=201")
+	assert.Contains(t, output.String(), "httpRequest.responseSize=7")
+	assert.Contains(t, output.String(), "httpRequest.userAgent=agent-given")
+	assert.Contains(t, output.String(), "httpRequest.remoteIp=203.0.113.7")
+	assert.Contains(t, output.String(), "httpRequest.latency=")
+	assert.Contains(t, output.String(), "requestId=")
+}
+
+func TestAccessLog_withExclude(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	s, err := newTestServer(t, config.Development, nil, map[string]string{
+		server.AccessLogExcludeEntry.Flag: "/healthz, /",
+	}, server.WithOutput(&output))
+	assert.Nil(t, err)
+	handleCreated(s)
+
+	// when
+	s.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// then
+	assert.NotContains(t, output.String(), "httpRequest")
+}
+
+func TestAccessLog_withSampling(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	s, err := newTestServer(t, config.Development, nil, map[string]string{
+		server.AccessLogSampleRateEntry.Flag: "0",
+	}, server.WithOutput(&output))
+	assert.Nil(t, err)
+	handleCreated(s)
+
+	// when
+	s.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/", nil))
+	s.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	// then
+	assert.NotContains(t, output.String(), "httpRequest.status=201")
+	assert.Contains(t, output.String(), "level=ERROR")
+	assert.Contains(t, output.String(), "httpRequest.status=502")
+}
+
+func TestAccessLog_withInvalidSampleRate_shouldFail(t *testing.T) {
+	// given
+	var output bytes.Buffer
+
+	// when
+	s, err := newTestServer(t, config.Development, nil, map[string]string{
+		server.AccessLogSampleRateEntry.Flag: "2",
+	}, server.WithOutput(&output))
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "access-log-sample-rate")
+	assert.Nil(t, s)
+}
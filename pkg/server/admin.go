@@ -0,0 +1,310 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/spf13/viper"
+)
+
+// redacted replaces the sensitive config values served by the admin
+// listener.
+const redacted = "REDACTED"
+
+// sensitiveKeys are the words marking a config key as sensitive, along with
+// the values it holds.
+var sensitiveKeys = []string{
+	"secret", "token", "password", "passwd", "credential", "private", "key",
+	"dsn",
+}
+
+// ServeAdmin listens on the address and serves the admin endpoints until the
+// context is done:
+//
+//   - /debug/pprof/ lists the [pprof] profiles, /debug/pprof/{name} serves
+//     one, /debug/pprof/profile a CPU profile and /debug/pprof/trace an
+//     execution trace, over the seconds parameter
+//   - /debug/goroutines dumps the goroutine stacks
+//   - /debug/build returns the build information
+//   - /debug/config returns the effective configuration, the sensitive
+//     values being redacted
+//   - /debug/routes lists the registered HTTP routes
+//   - /debug/features lists the features and their state
+//   - /debug/flags returns the rollout of the feature flags, in percent
+//   - /debug/metrics returns the server metrics
+//
+// The admin endpoints are not meant to be public: unless the address is a
+// loopback address, the requests must carry the [AdminTokenEntry] token as
+// a bearer token.
+//
+// [Server.ListenAndServe] serves the admin endpoints on the [AdminAddrEntry]
+// address, when set.
+func (s *Server) ServeAdmin(ctx context.Context, addr string) error {
+	handler, err := s.adminHandler(addr)
+	if err != nil {
+		return fmt.Errorf("adminHandler: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("net.Listen: %v", err)
+	}
+
+	adminServer := &http.Server{Handler: handler}
+	s.Logger.Printf("serving the admin endpoints on %s", addr)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- adminServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("adminServer.Serve: %v", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("adminServer.Shutdown: %v", err)
+	}
+
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("adminServer.Serve: %v", err)
+	}
+
+	return nil
+}
+
+// adminHandler returns the admin endpoints handler for the address. It
+// fails if the address is not a loopback address and no token is set.
+func (s *Server) adminHandler(addr string) (http.Handler, error) {
+	token := AdminTokenEntry.Value()
+	if token == "" && !isLoopback(addr) {
+		return nil, fmt.Errorf(
+			"%s entry is required to serve on %s", AdminTokenEntry.Flag, addr)
+	}
+
+	mux := http.NewServeMux()
+	// the profiles are served from runtime/pprof: net/http/pprof would
+	// register them on http.DefaultServeMux as well
+	mux.HandleFunc("/debug/pprof/", serveProfile)
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_ = pprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	mux.HandleFunc("/debug/build", func(w http.ResponseWriter, req *http.Request) {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			writeProblem(w, req, http.StatusNotFound, "no build information")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(info.String()))
+	})
+	mux.HandleFunc("/debug/config", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, redact(viper.AllSettings()))
+	})
+	mux.HandleFunc("/debug/routes", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, s.Routes())
+	})
+	mux.HandleFunc("/debug/features", func(w http.ResponseWriter, _ *http.Request) {
+		status := []features.FeatureStatus{}
+		if registryProvider, ok := s.fp.(features.RegistryProvider); ok {
+			status = registryProvider.Registry().Status()
+		}
+		writeJSON(w, status)
+	})
+	mux.HandleFunc("/debug/flags", func(w http.ResponseWriter, _ *http.Request) {
+		rollouts := map[string]float64{}
+		if s.flags != nil {
+			rollouts = s.flags.Rollouts()
+		}
+		writeJSON(w, rollouts)
+	})
+	mux.Handle("/debug/metrics", s.metrics)
+
+	if token == "" {
+		return mux, nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		given := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeProblem(w, req, http.StatusUnauthorized, "")
+			return
+		}
+
+		mux.ServeHTTP(w, req)
+	}), nil
+}
+
+// serveProfile serves the profile named by the path, the list of the
+// profiles on the index.
+func serveProfile(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(req.URL.Path, "/debug/pprof/")
+	switch name {
+	case "":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, profile := range pprof.Profiles() {
+			fmt.Fprintf(w, "%d\t%s\n", profile.Count(), profile.Name())
+		}
+		fmt.Fprintln(w, "\tprofile\n\ttrace")
+	case "profile":
+		serveRecording(
+			w, req, 30*time.Second, pprof.StartCPUProfile, pprof.StopCPUProfile)
+	case "trace":
+		serveRecording(w, req, time.Second, trace.Start, trace.Stop)
+	default:
+		profile := pprof.Lookup(name)
+		if profile == nil {
+			writeProblem(w, req, http.StatusNotFound, "unknown profile "+name)
+			return
+		}
+
+		debugLevel, _ := strconv.Atoi(req.URL.Query().Get("debug"))
+		if debugLevel > 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		_ = profile.WriteTo(w, debugLevel)
+	}
+}
+
+// serveRecording records into the response over the seconds parameter, or
+// the duration by default, unless the request is canceled first.
+func serveRecording(
+	w http.ResponseWriter, req *http.Request, duration time.Duration,
+	start func(io.Writer) error, stop func()) {
+
+	if seconds := req.URL.Query().Get("seconds"); seconds != "" {
+		value, err := strconv.ParseFloat(seconds, 64)
+		if err != nil || value <= 0 {
+			writeProblem(w, req, http.StatusBadRequest, "invalid seconds parameter")
+			return
+		}
+		duration = time.Duration(value * float64(time.Second))
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := start(w); err != nil {
+		writeProblem(w, req, http.StatusConflict, err.Error())
+		return
+	}
+	defer stop()
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-req.Context().Done():
+	}
+}
+
+// Routes returns the patterns of the registered HTTP handlers, sorted.
+func (s *Server) Routes() []string {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	routes := append([]string(nil), s.routes...)
+	sort.Strings(routes)
+	return routes
+}
+
+// isLoopback says if the address only listens on the loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// redact replaces the sensitive values of the settings. The values of the
+// sensitive keys are replaced whole, even when they are maps or lists, and
+// the passwords of the URLs are replaced wherever they are.
+func redact(settings map[string]any) map[string]any {
+	redactedSettings := make(map[string]any, len(settings))
+	for key, value := range settings {
+		if sensitiveKey(key) {
+			redactedSettings[key] = redacted
+			continue
+		}
+
+		redactedSettings[key] = redactValue(value)
+	}
+
+	return redactedSettings
+}
+
+// redactValue replaces the sensitive values nested in the value.
+func redactValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		return redact(value)
+	case []any:
+		redactedValues := make([]any, len(value))
+		for i, item := range value {
+			redactedValues[i] = redactValue(item)
+		}
+		return redactedValues
+	case string:
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return u.Redacted()
+			}
+		}
+	}
+
+	return value
+}
+
+// sensitiveKey says if the key holds sensitive values.
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range sensitiveKeys {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeJSON writes the value as a JSON response.
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	// the status is already sent, an encoding error cannot be surfaced
+	_ = encoder.Encode(value)
+}
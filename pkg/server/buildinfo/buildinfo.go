@@ -0,0 +1,79 @@
+// Package buildinfo reads the build information of the running program:
+// the version injected at link time, the module version and the VCS
+// revision recorded by the Go toolchain.
+//
+// The version can be injected when building:
+//
+//	go build -ldflags "-X github.com/planetfall/framework/pkg/server/buildinfo.Version=v1.2.3"
+package buildinfo
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Version is the version injected at link time, if any.
+var Version string
+
+// Info is the build information of the running program.
+type Info struct {
+	Version   string     `json:"version,omitempty"`  // the resolved version
+	Revision  string     `json:"revision,omitempty"` // the VCS revision
+	Time      *time.Time `json:"time,omitempty"`     // the VCS revision time, if any
+	Modified  bool       `json:"modified"`           // whether the tree was dirty
+	GoVersion string     `json:"goVersion"`          // the Go toolchain version
+	Path      string     `json:"path,omitempty"`     // the main package path
+}
+
+// The length of the revision used as version.
+const shortRevision = 12
+
+// Read returns the build information. The version is resolved in order from
+// the injected [Version], the main module version, and the VCS revision,
+// suffixed with "-dirty" when the tree was modified. It is empty when none
+// is known, such as in tests.
+func Read() Info {
+	info := Info{Version: Version}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.GoVersion = buildInfo.GoVersion
+	info.Path = buildInfo.Path
+
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			if revisionTime, err := time.Parse(time.RFC3339, setting.Value); err == nil {
+				info.Time = &revisionTime
+			}
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+
+	if info.Version != "" {
+		return info
+	}
+
+	if version := buildInfo.Main.Version; version != "" && version != "(devel)" {
+		info.Version = version
+		return info
+	}
+
+	if info.Revision != "" {
+		info.Version = info.Revision
+		if len(info.Version) > shortRevision {
+			info.Version = info.Version[:shortRevision]
+		}
+		if info.Modified {
+			info.Version += "-dirty"
+		}
+	}
+
+	return info
+}
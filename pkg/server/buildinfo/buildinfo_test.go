@@ -0,0 +1,35 @@
+package buildinfo_test
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/server/buildinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	// given
+	buildinfo.Version = "v1.2.3"
+	t.Cleanup(func() { buildinfo.Version = "" })
+
+	// when
+	info := buildinfo.Read()
+
+	// then
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+}
+
+func TestInfo_withoutTime_shouldOmitTime(t *testing.T) {
+	// given
+	info := buildinfo.Info{Version: "v1.2.3"}
+
+	// when
+	body, err := json.Marshal(info)
+
+	// then
+	assert.Nil(t, err)
+	assert.NotContains(t, string(body), `"time"`)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/planetfall/framework/pkg/server/correlation"
+)
+
+// newTrustedProxies returns the number of proxies set by the
+// [TrustedProxiesEntry] entry.
+func newTrustedProxies() (int, error) {
+	value := TrustedProxiesEntry.Value()
+	hops, err := strconv.Atoi(value)
+	if err != nil || hops < 0 {
+		return 0, fmt.Errorf("invalid %s value %q", TrustedProxiesEntry.Flag, value)
+	}
+
+	return hops, nil
+}
+
+// clientAddress returns a middleware resolving the client address of the
+// requests, behind the given number of trusted proxies. Each proxy appends
+// the address it received the request from to the X-Forwarded-For header,
+// so only the rightmost addresses can be trusted: the leftmost ones are set
+// by the client.
+func clientAddress(hops int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := correlation.NewClientIPContext(
+				req.Context(), forwardedIP(req, hops))
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// forwardedIP returns the address appended to the X-Forwarded-For header by
+// the outermost trusted proxy. It falls back to the peer address when there
+// is no trusted proxy, or when the header has fewer addresses than proxies.
+func forwardedIP(req *http.Request, hops int) string {
+	if hops == 0 {
+		return remoteIP(req)
+	}
+
+	var addresses []string
+	for _, value := range req.Header.Values("X-Forwarded-For") {
+		for _, address := range strings.Split(value, ",") {
+			addresses = append(addresses, strings.TrimSpace(address))
+		}
+	}
+
+	if len(addresses) < hops || addresses[len(addresses)-hops] == "" {
+		return remoteIP(req)
+	}
+
+	return addresses[len(addresses)-hops]
+}
+
+// clientIP returns the client address resolved by the server, or else the
+// peer address.
+func clientIP(req *http.Request) string {
+	if ip, ok := correlation.ClientIPFromContext(req.Context()); ok {
+		return ip
+	}
+
+	return remoteIP(req)
+}
+
+// remoteIP returns the host of the peer address.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,56 @@
+// Package correlation stores the identifiers correlating the work done for a
+// request into a context, along with the address of the client.
+//
+// The [server] package sets them for every HTTP request and gRPC call. They
+// are read by the structured logger and by the features propagating them,
+// such as the Pub/Sub publisher, or reporting them, such as the error
+// reporter.
+package correlation
+
+import "context"
+
+// IDs holds the correlation identifiers of a request.
+type IDs struct {
+	RequestID string // the request identifier
+	TraceID   string // the trace identifier, if any
+	SpanID    string // the span identifier in hexadecimal, if any
+}
+
+// TraceParent returns the W3C traceparent value of the identifiers, or an
+// empty string if the trace or span identifiers are not in the W3C format.
+func (ids IDs) TraceParent() string {
+	if len(ids.TraceID) != 32 || len(ids.SpanID) != 16 {
+		return ""
+	}
+
+	return "00-" + ids.TraceID + "-" + ids.SpanID + "-01"
+}
+
+// contextKey is the type of the context key of the identifiers.
+type contextKey struct{}
+
+// clientIPKey is the type of the context key of the client address.
+type clientIPKey struct{}
+
+// NewContext returns a copy of the context holding the identifiers.
+func NewContext(ctx context.Context, ids IDs) context.Context {
+	return context.WithValue(ctx, contextKey{}, ids)
+}
+
+// FromContext returns the identifiers stored in the context.
+func FromContext(ctx context.Context) (IDs, bool) {
+	ids, ok := ctx.Value(contextKey{}).(IDs)
+	return ids, ok
+}
+
+// NewClientIPContext returns a copy of the context holding the client
+// address, resolved behind the trusted proxies.
+func NewClientIPContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client address stored in the context.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/planetfall/framework/pkg/config"
+)
+
+// cors applies a CORS policy to the requests.
+type cors struct {
+	origins        []string        // the allowed origins, in lower case
+	methods        map[string]bool // the allowed methods
+	methodsValue   string          // the Access-Control-Allow-Methods value
+	headers        map[string]bool // the allowed headers, canonicalized
+	anyHeader      bool            // whether any header is allowed
+	exposedHeaders string          // the Access-Control-Expose-Headers value
+	credentials    bool            // whether credentials are allowed
+	maxAge         string          // the Access-Control-Max-Age value
+}
+
+// newCORS creates the CORS policy from the config entries. It returns nil
+// when no origin is allowed.
+//
+// In Development, the origins and the headers default to any origin and any
+// header, so local front-ends work without configuration. On a Cloud
+// environment, only the configured origins are allowed.
+func newCORS(environment config.Environment) (*cors, error) {
+	origins := CORSOriginsEntry.Values()
+	headers := CORSHeadersEntry.Values()
+	if !environment.OnCloud() {
+		if len(origins) == 0 {
+			origins = []string{"*"}
+		}
+		if len(headers) == 0 {
+			headers = []string{"*"}
+		}
+	}
+
+	if len(origins) == 0 {
+		return nil, nil
+	}
+
+	credentials, err := strconv.ParseBool(CORSCredentialsEntry.Value())
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q",
+			CORSCredentialsEntry.Flag, CORSCredentialsEntry.Value())
+	}
+
+	maxAge := CORSMaxAgeEntry.Value()
+	if seconds, err := strconv.Atoi(maxAge); err != nil || seconds < 0 {
+		return nil, fmt.Errorf("invalid %s value %q", CORSMaxAgeEntry.Flag, maxAge)
+	}
+
+	c := &cors{
+		methods:        make(map[string]bool),
+		headers:        make(map[string]bool),
+		exposedHeaders: strings.Join(CORSExposedHeadersEntry.Values(), ", "),
+		credentials:    credentials,
+		maxAge:         maxAge,
+	}
+
+	for _, origin := range origins {
+		// any origin could read the responses with the user credentials
+		if origin == "*" && credentials {
+			return nil, fmt.Errorf("%s * cannot be used with %s",
+				CORSOriginsEntry.Flag, CORSCredentialsEntry.Flag)
+		}
+
+		if strings.Count(origin, "*") > 1 ||
+			(origin != "*" && strings.Contains(origin, "*") &&
+				!strings.Contains(origin, "://*.")) {
+
+			return nil, fmt.Errorf("invalid %s origin %q",
+				CORSOriginsEntry.Flag, origin)
+		}
+		c.origins = append(c.origins, strings.ToLower(origin))
+	}
+
+	methods := CORSMethodsEntry.Values()
+	for _, method := range methods {
+		c.methods[strings.ToUpper(method)] = true
+	}
+	c.methodsValue = strings.ToUpper(strings.Join(methods, ", "))
+
+	for _, header := range headers {
+		if header == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return c, nil
+}
+
+// allowOrigin says if the origin is allowed. An origin pattern such as
+// "https://*.example.com" allows the subdomains of example.com.
+func (c *cors) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.origins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		prefix, suffix, wildcard := strings.Cut(allowed, "*")
+		if wildcard && len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) &&
+			strings.HasSuffix(origin, suffix) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowHeaders says if the comma-separated request headers are allowed.
+func (c *cors) allowHeaders(requested string) bool {
+	if c.anyHeader {
+		return true
+	}
+
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !c.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// middleware applies the policy: the preflight requests are answered, and
+// the CORS headers are added to the responses of the allowed origins.
+func (c *cors) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		origin := req.Header.Get("Origin")
+		preflight := req.Method == http.MethodOptions &&
+			req.Header.Get("Access-Control-Request-Method") != ""
+
+		if !preflight {
+			if origin != "" && c.allowOrigin(origin) {
+				c.setOrigin(header, origin)
+				if c.exposedHeaders != "" {
+					header.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+				}
+			}
+
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+
+		// a rejected preflight gets no CORS header, the browser blocks the
+		// request
+		method := req.Header.Get("Access-Control-Request-Method")
+		requestedHeaders := req.Header.Get("Access-Control-Request-Headers")
+		if origin != "" && c.allowOrigin(origin) && c.methods[method] &&
+			c.allowHeaders(requestedHeaders) {
+
+			c.setOrigin(header, origin)
+			header.Set("Access-Control-Allow-Methods", c.methodsValue)
+			if requestedHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", requestedHeaders)
+			}
+			header.Set("Access-Control-Max-Age", c.maxAge)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// setOrigin allows the origin, and the credentials if configured. The origin
+// is echoed rather than "*", so the credentials can be allowed for the
+// listed origins.
+func (c *cors) setOrigin(header http.Header, origin string) {
+	header.Set("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,153 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// handleItems registers the "/items" route the CORS requests are sent to.
+func handleItems(s *server.Server) {
+	s.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// corsRequest sends a request from the origin, as a preflight if the
+// requested method is set.
+func corsRequest(
+	s *server.Server, origin, requestedMethod, requestedHeaders string) *httptest.ResponseRecorder {
+
+	method := http.MethodGet
+	if requestedMethod != "" {
+		method = http.MethodOptions
+	}
+
+	req := httptest.NewRequest(method, "/items", nil)
+	req.Header.Set("Origin", origin)
+	if requestedMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", requestedMethod)
+	}
+	if requestedHeaders != "" {
+		req.Header.Set("Access-Control-Request-Headers", requestedHeaders)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORS(t *testing.T) {
+	// given
+	s, err := newTestServer(
+		t, config.Production, &featureProviderMock{}, map[string]string{
+			server.CORSOriginsEntry.Flag:     "https://app.example.com,https://*.planetfall.io",
+			server.CORSHeadersEntry.Flag:     "Content-Type,Authorization",
+			server.CORSCredentialsEntry.Flag: "true",
+		})
+	assert.Nil(t, err)
+	handleItems(s)
+
+	// when
+	allowed := corsRequest(s, "https://app.example.com", "", "")
+	subdomain := corsRequest(s, "https://console.planetfall.io", "", "")
+	apex := corsRequest(s, "https://planetfall.io", "", "")
+	other := corsRequest(s, "https://evil.com", "", "")
+
+	// then
+	assert.Equal(t, http.StatusOK, allowed.Code)
+	assert.Equal(t, "https://app.example.com",
+		allowed.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true",
+		allowed.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Request-Id",
+		allowed.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, []string{"Origin"}, allowed.Header().Values("Vary"))
+
+	assert.Equal(t, "https://console.planetfall.io",
+		subdomain.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, apex.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.StatusOK, other.Code)
+	assert.Empty(t, other.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_withPreflight(t *testing.T) {
+	// given
+	s, err := newTestServer(
+		t, config.Production, &featureProviderMock{}, map[string]string{
+			server.CORSOriginsEntry.Flag: "https://app.example.com",
+			server.CORSHeadersEntry.Flag: "Content-Type",
+			server.CORSMethodsEntry.Flag: "GET,POST",
+		})
+	assert.Nil(t, err)
+	handleItems(s)
+
+	// when
+	allowed := corsRequest(s, "https://app.example.com", "POST", "content-type")
+	badMethod := corsRequest(s, "https://app.example.com", "DELETE", "")
+	badHeader := corsRequest(s, "https://app.example.com", "POST", "X-Secret")
+
+	// then
+	assert.Equal(t, http.StatusNoContent, allowed.Code)
+	assert.Equal(t, "https://app.example.com",
+		allowed.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST",
+		allowed.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type",
+		allowed.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", allowed.Header().Get("Access-Control-Max-Age"))
+	assert.Empty(t, allowed.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, []string{
+		"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers",
+	}, allowed.Header().Values("Vary"))
+
+	assert.Equal(t, http.StatusNoContent, badMethod.Code)
+	assert.Empty(t, badMethod.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, badHeader.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_withEnvironmentDefaults(t *testing.T) {
+	// given
+	prd, err := newTestServer(t, config.Production, &featureProviderMock{}, nil)
+	assert.Nil(t, err)
+	handleItems(prd)
+	dev, err := newTestServer(t, config.Development, nil, nil)
+	assert.Nil(t, err)
+
+	// when
+	recPrd := corsRequest(prd, "http://localhost:3000", "POST", "X-Custom")
+	recDev := corsRequest(dev, "http://localhost:3000", "POST", "X-Custom")
+	recNoOrigin := corsRequest(dev, "", "POST", "")
+
+	// then
+	assert.Empty(t, recPrd.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, recPrd.Header().Values("Vary"))
+	assert.Equal(t, "http://localhost:3000",
+		recDev.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Custom",
+		recDev.Header().Get("Access-Control-Allow-Headers"))
+	assert.Empty(t, recNoOrigin.Header().Values("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_withInvalidEntries(t *testing.T) {
+	// given
+	valuesGiven := []map[string]string{
+		{server.CORSOriginsEntry.Flag: "https://app.*.com"},
+		{server.CORSOriginsEntry.Flag: "*", server.CORSMaxAgeEntry.Flag: "-1"},
+		{server.CORSOriginsEntry.Flag: "*", server.CORSCredentialsEntry.Flag: "maybe"},
+		{server.CORSOriginsEntry.Flag: "*", server.CORSCredentialsEntry.Flag: "true"},
+	}
+
+	for _, values := range valuesGiven {
+		// when
+		_, err := newTestServer(
+			t, config.Production, &featureProviderMock{}, values)
+
+		// then
+		assert.NotNil(t, err, values)
+	}
+}
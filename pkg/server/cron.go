@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Job is a scheduled job. The context is done once the job timeout is
+// reached, or when the server is closed.
+type Job func(ctx context.Context) error
+
+// ScheduleConfig configures a scheduled job.
+type ScheduleConfig struct {
+	// Jitter is the maximum random delay added to each run, to spread the
+	// runs of the service instances.
+	Jitter time.Duration
+	// Timeout bounds each run. The runs are not bounded when 0.
+	Timeout time.Duration
+	// Endpoint is the pattern of an HTTP endpoint triggering the job, such
+	// as "/jobs/cleanup", for Cloud Scheduler. On a Cloud environment, the
+	// job is then only run by the endpoint, and not by the server itself.
+	Endpoint string
+	// OIDC configures the verification of the endpoint authentication token.
+	OIDC OIDCConfig
+}
+
+// scheduledJob is a job and its overlap guard.
+type scheduledJob struct {
+	name    string        // the job name
+	job     Job           // the job function
+	timeout time.Duration // the run timeout, if any
+	running sync.Mutex    // held while the job runs
+}
+
+// Schedule runs the job following the cron expression, such as
+// "0 3 * * *" or "@every 1h". It fails if the expression is invalid.
+//
+// A run is skipped when the previous one is not over. The failing runs are
+// raised, the runs are measured in the "cron_runs" and
+// "cron_duration_seconds" metrics, and the skipped runs counted in
+// "cron_skipped". The schedule stops once the server is closed.
+func (s *Server) Schedule(
+	name, spec string, job Job, cfg ScheduleConfig) error {
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("cron.ParseStandard: %v", err)
+	}
+
+	j := &scheduledJob{name: name, job: job, timeout: cfg.Timeout}
+
+	if cfg.Endpoint != "" {
+		if err := s.checkOIDC(cfg.OIDC); err != nil {
+			return fmt.Errorf("checkOIDC: %v", err)
+		}
+
+		s.Handle(cfg.Endpoint, s.jobHandler(j, cfg.OIDC))
+
+		// Cloud Scheduler triggers the job instead
+		if s.cfg.Environment().OnCloud() {
+			return nil
+		}
+	}
+
+	s.Go("cron/"+name, func(ctx context.Context) error {
+		for {
+			next := schedule.Next(time.Now())
+			if cfg.Jitter > 0 {
+				next = next.Add(time.Duration(rand.Int63n(int64(cfg.Jitter))))
+			}
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			}
+
+			if ran, err := s.runScheduled(ctx, j); !ran {
+				s.Logger.Printf("job %s skipped, the previous run is not over", name)
+			} else if err != nil {
+				s.raise(ctx, "job "+name, err, nil)
+			}
+		}
+	})
+
+	return nil
+}
+
+// jobHandler returns the handler triggering the job. It answers with a
+// conflict when the job is already running.
+func (s *Server) jobHandler(j *scheduledJob, oidc OIDCConfig) http.Handler {
+	return s.Handler(func(w http.ResponseWriter, req *http.Request) error {
+		if req.Method != http.MethodPost && req.Method != http.MethodGet {
+			return InvalidArgument("job requests must use POST or GET", nil)
+		}
+
+		if err := s.verifyOIDC(req, oidc); err != nil {
+			return err
+		}
+
+		ran, err := s.runScheduled(req.Context(), j)
+		if !ran {
+			return Conflict(fmt.Sprintf("job %s is already running", j.name), nil)
+		}
+		if err != nil {
+			return Internal(fmt.Sprintf("job %s failed", j.name), err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// runScheduled runs the job once, unless it is already running. It returns
+// whether the job ran, and its error. A panic is turned into an error.
+func (s *Server) runScheduled(
+	ctx context.Context, j *scheduledJob) (ran bool, err error) {
+
+	if !j.running.TryLock() {
+		s.metrics.Map("cron_skipped").Add(j.name, 1)
+		return false, nil
+	}
+	defer j.running.Unlock()
+
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = newPanicError(recovered)
+		}
+
+		outcome := "ok"
+		if err != nil {
+			outcome = "failed"
+		}
+		s.metrics.Map("cron_runs").Add(j.name+" "+outcome, 1)
+		s.metrics.Map("cron_duration_seconds").
+			AddFloat(j.name, time.Since(start).Seconds())
+	}()
+
+	return true, j.job(ctx)
+}
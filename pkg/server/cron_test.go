@@ -0,0 +1,128 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSchedule(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	output := &bytes.Buffer{}
+	s, err := server.NewServer(context.Background(), cfgGiven, "service-name",
+		server.WithOutput(output))
+	assert.Nil(t, err)
+	var runs atomic.Int32
+
+	// when
+	err = s.Schedule("cleanup", "@every 1s", func(ctx context.Context) error {
+		if runs.Add(1) == 1 {
+			return fmt.Errorf("database unavailable")
+		}
+		return nil
+	}, server.ScheduleConfig{Timeout: time.Second})
+
+	// then
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return runs.Load() >= 2 },
+		3*time.Second, 10*time.Millisecond)
+	assert.Nil(t, s.Close())
+	assert.Contains(t, output.String(), "job cleanup: database unavailable")
+	assert.Contains(t, s.Metrics().Get("cron_runs").String(),
+		`"cleanup failed": 1`)
+}
+
+func TestSchedule_withInvalidSpec(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(context.Background(), cfgGiven, "service-name")
+	assert.Nil(t, err)
+
+	// when
+	err = s.Schedule("cleanup", "every hour",
+		func(ctx context.Context) error { return nil }, server.ScheduleConfig{})
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestSchedule_withEndpoint(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var runs atomic.Int32
+
+	err = s.Schedule("cleanup", "@every 10ms", func(ctx context.Context) error {
+		runs.Add(1)
+		close(started)
+		<-release
+		return nil
+	}, server.ScheduleConfig{
+		Endpoint: "/jobs/cleanup",
+		OIDC: server.OIDCConfig{
+			ServiceAccount: "scheduler@project.iam.gserviceaccount.com",
+			Validator:      validatorStub("scheduler@project.iam.gserviceaccount.com"),
+		},
+	})
+	assert.Nil(t, err)
+
+	trigger := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/jobs/cleanup", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// when
+	recInvalid := trigger("invalid")
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- trigger("valid") }()
+	<-started
+	recOverlap := trigger("valid")
+	close(release)
+	recFirst := <-first
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, recInvalid.Code)
+	assert.Equal(t, http.StatusConflict, recOverlap.Code)
+	assert.Equal(t, http.StatusNoContent, recFirst.Code)
+
+	// the server itself does not run the job on a Cloud environment
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, int32(1), runs.Load())
+	assert.Nil(t, s.Close())
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestSchedule_withEndpointWithoutServiceAccount_shouldFail(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+
+	// when
+	err = s.Schedule("cleanup", "@every 1h", func(ctx context.Context) error {
+		return nil
+	}, server.ScheduleConfig{Endpoint: "/jobs/cleanup"})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "service account")
+}
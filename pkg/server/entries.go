@@ -0,0 +1,167 @@
+package server
+
+import (
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server/features"
+)
+
+// PortEntry is the config entry of the port the server listens on. Cloud Run
+// sets it through the PORT environment variable.
+var PortEntry = config.Entry{
+	Flag:         "port",
+	DefaultValue: "8080",
+	Description:  "the port the server listens on",
+	EnvKey:       "PORT",
+}
+
+// The access log config entries.
+var (
+	AccessLogSampleRateEntry = config.Entry{
+		Flag:         "access-log-sample-rate",
+		DefaultValue: "1",
+		Description:  "the ratio of requests logged, between 0 and 1",
+		EnvKey:       "ACCESS_LOG_SAMPLE_RATE",
+	}
+
+	AccessLogExcludeEntry = config.Entry{
+		Flag:         "access-log-exclude",
+		DefaultValue: "",
+		Description:  "the comma-separated paths never logged",
+		EnvKey:       "ACCESS_LOG_EXCLUDE",
+	}
+)
+
+// TrustedProxiesEntry is the config entry of the number of proxies in front
+// of the server, such as the Cloud Run front end. The client address is the
+// one appended to the X-Forwarded-For header by the outermost of them. With
+// no proxy, it is the peer address.
+var TrustedProxiesEntry = config.Entry{
+	Flag:         "trusted-proxies",
+	DefaultValue: "1",
+	Description:  "the number of proxies appending to the X-Forwarded-For header",
+	EnvKey:       "TRUSTED_PROXIES",
+}
+
+// VersionPathEntry is the config entry of the path serving the build
+// information, see [Server.BuildInfo]. A service handling the "/version"
+// path itself opts out with an empty value.
+var VersionPathEntry = config.Entry{
+	Flag:         "version-path",
+	DefaultValue: "/version",
+	Description:  "the path serving the build information, disabled if empty",
+	EnvKey:       "VERSION_PATH",
+}
+
+// The rate limit config entries.
+var (
+	RateLimitEntry = config.Entry{
+		Flag:         "rate-limit",
+		DefaultValue: "",
+		Description:  "the requests per second allowed on every route, as rate[:burst]",
+		EnvKey:       "RATE_LIMIT",
+	}
+
+	RateLimitRoutesEntry = config.Entry{
+		Flag:         "rate-limit-routes",
+		DefaultValue: "",
+		Description:  "the comma-separated route limits, as pattern=rate[:burst]",
+		EnvKey:       "RATE_LIMIT_ROUTES",
+	}
+
+	RateLimitKeyEntry = config.Entry{
+		Flag:         "rate-limit-key",
+		DefaultValue: "ip",
+		Description:  "the key the requests are limited by: ip, principal or header:<name>",
+		EnvKey:       "RATE_LIMIT_KEY",
+	}
+)
+
+// The CORS config entries. In Development, the origins and the headers
+// default to any.
+var (
+	CORSOriginsEntry = config.Entry{
+		Flag:         "cors-origins",
+		DefaultValue: "",
+		Description:  "the comma-separated allowed origins, such as https://*.example.com",
+		EnvKey:       "CORS_ORIGINS",
+	}
+
+	CORSMethodsEntry = config.Entry{
+		Flag:         "cors-methods",
+		DefaultValue: "GET,HEAD,POST,PUT,PATCH,DELETE",
+		Description:  "the comma-separated allowed methods",
+		EnvKey:       "CORS_METHODS",
+	}
+
+	CORSHeadersEntry = config.Entry{
+		Flag:         "cors-headers",
+		DefaultValue: "",
+		Description:  "the comma-separated allowed request headers, or *",
+		EnvKey:       "CORS_HEADERS",
+	}
+
+	CORSExposedHeadersEntry = config.Entry{
+		Flag:         "cors-exposed-headers",
+		DefaultValue: RequestIDHeader,
+		Description:  "the comma-separated response headers exposed to the browser",
+		EnvKey:       "CORS_EXPOSED_HEADERS",
+	}
+
+	CORSCredentialsEntry = config.Entry{
+		Flag:         "cors-credentials",
+		DefaultValue: "false",
+		Description:  "whether the requests can carry credentials",
+		EnvKey:       "CORS_CREDENTIALS",
+	}
+
+	CORSMaxAgeEntry = config.Entry{
+		Flag:         "cors-max-age",
+		DefaultValue: "600",
+		Description:  "the seconds the preflight responses are cached",
+		EnvKey:       "CORS_MAX_AGE",
+	}
+)
+
+// The admin listener config entries.
+var (
+	AdminAddrEntry = config.Entry{
+		Flag:         "admin-addr",
+		DefaultValue: "",
+		Description:  "the address of the admin listener, such as 127.0.0.1:9090, disabled if empty",
+		EnvKey:       "ADMIN_ADDR",
+	}
+
+	AdminTokenEntry = config.Entry{
+		Flag:         "admin-token",
+		DefaultValue: "",
+		Description:  "the bearer token of the admin endpoints, required unless on loopback",
+		EnvKey:       "ADMIN_TOKEN",
+	}
+)
+
+// Entries returns the config entries read by the server and its default
+// features. They can be given to [config.NewConfig] so their values can be
+// set from the program arguments and the environment. Otherwise, only the
+// config file values are used.
+func Entries() []config.Entry {
+	entries := []config.Entry{
+		PortEntry,
+		TrustedProxiesEntry,
+		VersionPathEntry,
+		AccessLogSampleRateEntry,
+		AccessLogExcludeEntry,
+		RateLimitEntry,
+		RateLimitRoutesEntry,
+		RateLimitKeyEntry,
+		CORSOriginsEntry,
+		CORSMethodsEntry,
+		CORSHeadersEntry,
+		CORSExposedHeadersEntry,
+		CORSCredentialsEntry,
+		CORSMaxAgeEntry,
+		AdminAddrEntry,
+		AdminTokenEntry,
+	}
+
+	return append(entries, features.Entries()...)
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/planetfall/framework/pkg/server/features"
+)
+
+// Kind classifies the application errors. Each kind maps to an HTTP status.
+type Kind int
+
+// The application error kinds.
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindInvalidArgument
+	KindUnauthenticated
+	KindPermissionDenied
+	KindConflict
+	KindUnavailable
+)
+
+// kindStatus maps the error kinds to their HTTP status.
+var kindStatus = map[Kind]int{
+	KindInternal:         http.StatusInternalServerError,
+	KindNotFound:         http.StatusNotFound,
+	KindInvalidArgument:  http.StatusBadRequest,
+	KindUnauthenticated:  http.StatusUnauthorized,
+	KindPermissionDenied: http.StatusForbidden,
+	KindConflict:         http.StatusConflict,
+	KindUnavailable:      http.StatusServiceUnavailable,
+}
+
+// Status returns the HTTP status of the kind.
+func (k Kind) Status() int {
+	if status, ok := kindStatus[k]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// String returns the HTTP status text of the kind.
+func (k Kind) String() string {
+	return http.StatusText(k.Status())
+}
+
+// Error is an application error. Its message is meant to be read by the
+// client, while the wrapped error is only logged and reported.
+type Error struct {
+	Kind    Kind   // the error kind
+	Message string // the message exposed to the client
+	Err     error  // the underlying error, can be nil
+}
+
+// Error returns the message followed by the underlying error.
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError creates an application error carrying the stack trace of the
+// caller, so the reported errors are grouped by where they were created.
+func newError(kind Kind, message string, err error) error {
+	return features.WithStackSkipping(
+		&Error{Kind: kind, Message: message, Err: err}, frameworkPrefix)
+}
+
+// NotFound creates an error for a missing resource.
+func NotFound(message string, err error) error {
+	return newError(KindNotFound, message, err)
+}
+
+// InvalidArgument creates an error for an invalid client input.
+func InvalidArgument(message string, err error) error {
+	return newError(KindInvalidArgument, message, err)
+}
+
+// Unauthenticated creates an error for missing or invalid credentials.
+func Unauthenticated(message string, err error) error {
+	return newError(KindUnauthenticated, message, err)
+}
+
+// PermissionDenied creates an error for a client lacking permissions.
+func PermissionDenied(message string, err error) error {
+	return newError(KindPermissionDenied, message, err)
+}
+
+// Conflict creates an error for a request conflicting with the current state.
+func Conflict(message string, err error) error {
+	return newError(KindConflict, message, err)
+}
+
+// Unavailable creates an error for a temporarily unavailable service.
+func Unavailable(message string, err error) error {
+	return newError(KindUnavailable, message, err)
+}
+
+// Internal creates an error for an unexpected failure.
+func Internal(message string, err error) error {
+	return newError(KindInternal, message, err)
+}
+
+// problemContentType is the media type of the RFC 7807 problem details.
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type     string `json:"type"`               // the problem type URI
+	Title    string `json:"title"`              // the status text
+	Status   int    `json:"status"`             // the HTTP status
+	Detail   string `json:"detail,omitempty"`   // the error message
+	Instance string `json:"instance,omitempty"` // the request path
+}
+
+// writeProblem writes a problem details response.
+func writeProblem(
+	w http.ResponseWriter, req *http.Request, status int, detail string) {
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	// the status is already sent, an encoding error cannot be surfaced
+	_ = json.NewEncoder(w).Encode(Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: req.URL.Path,
+	})
+}
+
+// HandlerFunc is an HTTP handler returning an error. Use [Server.Handler] to
+// turn it into an [http.Handler].
+type HandlerFunc func(w http.ResponseWriter, req *http.Request) error
+
+// Handler adapts the handler function into an [http.Handler]. The errors
+// returned by the function are written using [Server.WriteError].
+//
+// The errors created by [NotFound], [Internal] and the other constructors
+// carry the stack trace of their creation. The other errors get the stack
+// trace of the handler, as they are received once it returned.
+func (s *Server) Handler(h HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := newResponseWriter(w)
+		if err := h(rw, req); err != nil {
+			s.writeError(rw, req, withFuncStack(err, h))
+		}
+	})
+}
+
+// recoverHandler recovers the panics of the handlers, raises them with their
+// stack and answers a 500, unless the handler already wrote the response
+// header. The [http.ErrAbortHandler] panics abort the response as usual.
+func (s *Server) recoverHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := newResponseWriter(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			s.raise(req.Context(), "handler panicked", newPanicError(recovered), req)
+			if !rw.wroteHeader {
+				writeProblem(rw, req, http.StatusInternalServerError, "")
+			}
+		}()
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// WriteError writes the error as a problem details response. Errors that are
+// not of type [*Error] are considered internal. Only the errors with a 5xx
+// status are raised, and their message is only exposed if it is an [*Error].
+//
+// A body exceeding the limit set by [Server.RequestLimit] is answered with a
+// 413, and an error caused by the request deadline with a 503 that is not
+// raised.
+func (s *Server) WriteError(w http.ResponseWriter, req *http.Request, err error) {
+	s.writeError(newResponseWriter(w), req, err)
+}
+
+// writeError writes the error response unless the handler already wrote the
+// response header.
+func (s *Server) writeError(
+	w *responseWriter, req *http.Request, err error) {
+
+	status := http.StatusInternalServerError
+	detail := ""
+
+	timeout := false
+
+	var appErr *Error
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &appErr):
+		status = appErr.Kind.Status()
+		detail = appErr.Message
+	case errors.As(err, &maxBytesErr):
+		status = http.StatusRequestEntityTooLarge
+		detail = fmt.Sprintf("the request body exceeds %d bytes", maxBytesErr.Limit)
+	case errors.Is(err, context.DeadlineExceeded) &&
+		errors.Is(req.Context().Err(), context.DeadlineExceeded):
+
+		// the timeouts are measured by the request limit middleware
+		status = http.StatusServiceUnavailable
+		timeout = true
+	}
+
+	if status >= http.StatusInternalServerError && !timeout {
+		s.Raise("handler failed", err, req)
+	}
+
+	if w.wroteHeader {
+		return
+	}
+
+	writeProblem(w, req, status, detail)
+}
+
+// frameworkPrefix prefixes the functions of this package, skipped by the
+// stack traces of the raised errors.
+var frameworkPrefix = reflect.TypeOf((*Server)(nil)).Elem().PkgPath() + "."
+
+// panicError is a recovered panic, along the stack of the goroutine that
+// panicked.
+type panicError struct {
+	recovered any    // the value given to panic
+	stack     []byte // the goroutine stack, from the panicking frame
+}
+
+// newPanicError returns the error of a recovered panic. It must be called by
+// the deferred function recovering the panic, so the stack is the one of the
+// panicking goroutine.
+func newPanicError(recovered any) *panicError {
+	return &panicError{
+		recovered: recovered,
+		stack:     trimPanicStack(debug.Stack()),
+	}
+}
+
+// Error returns the panic value, as the panic message.
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.recovered)
+}
+
+// StackTrace returns the stack of the goroutine that panicked.
+func (e *panicError) StackTrace() []byte {
+	return e.stack
+}
+
+// withFuncStack returns the error along the stack of the caller, topped
+// with the frame of the function that returned it, such as a handler or a
+// worker, unless the error already carries a stack trace. The errors of
+// different functions are told apart.
+func withFuncStack(err error, fn any) error {
+	var tracer features.StackTracer
+	if errors.As(err, &tracer) {
+		return err
+	}
+
+	traced := features.WithStackSkipping(err, frameworkPrefix)
+	if !errors.As(traced, &tracer) {
+		return traced
+	}
+
+	header, frames, ok := bytes.Cut(tracer.StackTrace(), []byte("\n"))
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if !ok || f == nil {
+		return traced
+	}
+
+	// header and frames share the array of the trace, appending to header
+	// would overwrite frames
+	file, line := f.FileLine(f.Entry())
+	stack := append(append([]byte(nil), header...), '\n')
+	stack = fmt.Appendf(stack, "%s(...)\n\t%s:%d +0x0\n", f.Name(), file, line)
+	return &funcError{err: err, stack: append(stack, frames...)}
+}
+
+// funcError is an error returned by a function, such as a handler or a
+// worker, along the stack trace of the function.
+type funcError struct {
+	err   error  // the function error
+	stack []byte // the stack trace, topped with the function frame
+}
+
+// Error returns the function error message.
+func (e *funcError) Error() string { return e.err.Error() }
+
+// Unwrap returns the function error.
+func (e *funcError) Unwrap() error { return e.err }
+
+// StackTrace returns the stack trace of the function.
+func (e *funcError) StackTrace() []byte { return e.stack }
+
+// trimPanicStack removes the frames recovering the panic from the stack, so
+// it starts with the panicking frame.
+func trimPanicStack(stack []byte) []byte {
+	header, frames, ok := bytes.Cut(stack, []byte("\n"))
+	if !ok {
+		return stack
+	}
+
+	_, afterPanic, ok := bytes.Cut(frames, []byte("\npanic("))
+	if !ok {
+		return stack
+	}
+
+	// the panic call is followed by its file line
+	_, afterPanic, ok = bytes.Cut(afterPanic, []byte("\n"))
+	if !ok {
+		return stack
+	}
+	_, afterPanic, ok = bytes.Cut(afterPanic, []byte("\n"))
+	if !ok {
+		return stack
+	}
+
+	trimmed := append(header, '\n')
+	return append(trimmed, afterPanic...)
+}
@@ -0,0 +1,211 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestError(t *testing.T) {
+	// given
+	causeGiven := fmt.Errorf("row missing")
+
+	// when
+	err := server.NotFound("user not found", causeGiven)
+
+	// then
+	assert.Equal(t, "user not found: row missing", err.Error())
+	assert.ErrorIs(t, err, causeGiven)
+}
+
+func TestError_shouldCarryStack(t *testing.T) {
+	// when
+	err := findUser()
+
+	var tracer features.StackTracer
+	ok := errors.As(err, &tracer)
+
+	// then
+	assert.True(t, ok)
+	assert.Regexp(t,
+		`^goroutine \d+ \[running\]:\n\S+/server_test\.findUser\(\.\.\.\)\n`,
+		string(tracer.StackTrace()))
+}
+
+func findUser() error {
+	return server.Internal("user lookup failed", nil)
+}
+
+func TestKind_Status(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, server.KindNotFound.Status())
+	assert.Equal(t, http.StatusBadRequest, server.KindInvalidArgument.Status())
+	assert.Equal(t, http.StatusUnauthorized, server.KindUnauthenticated.Status())
+	assert.Equal(t, http.StatusForbidden, server.KindPermissionDenied.Status())
+	assert.Equal(t, http.StatusConflict, server.KindConflict.Status())
+	assert.Equal(t, http.StatusServiceUnavailable, server.KindUnavailable.Status())
+	assert.Equal(t, http.StatusInternalServerError, server.KindInternal.Status())
+	assert.Equal(t, http.StatusInternalServerError, server.Kind(-1).Status())
+}
+
+func TestHandler_withClientError(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
+	assert.Nil(t, err)
+
+	h := s.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		return server.InvalidArgument("name is required", nil)
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+	var problem server.Problem
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&problem))
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, server.Problem{
+		Type:     "about:blank",
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   "name is required",
+		Instance: "/users",
+	}, problem)
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestHandler_withUntypedError(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+	errorGiven := fmt.Errorf("database password rejected")
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+	fpGiven.On("Report", mock.Anything).Return()
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
+	assert.Nil(t, err)
+
+	h := s.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		return errorGiven
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), errorGiven.Error())
+	fpGiven.AssertExpectations(t)
+}
+
+func TestHandler_withUntypedError_shouldCarryHandlerStack(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+
+	var reported error
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+	fpGiven.On("Report", mock.Anything).Run(func(args mock.Arguments) {
+		reported = args.Error(0)
+	}).Return()
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
+	assert.Nil(t, err)
+
+	h := s.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("database unreachable")
+	})
+
+	// when
+	h.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	var tracer features.StackTracer
+	ok := errors.As(reported, &tracer)
+
+	// then
+	assert.True(t, ok)
+	assert.Regexp(t,
+		`^goroutine \d+ \[running\]:\n\S+/server_test\.TestHandler_withUntypedError_shouldCarryHandlerStack\.func\d+\(\.\.\.\)\n\t\S+/errors_test\.go:\d+ \+0x0\n`+
+			`(?:\S+\(.*\)\n\t\S+ \+0x[0-9a-f]+\n)*`+
+			`\S+/server_test\.TestHandler_withUntypedError_shouldCarryHandlerStack\(.*\)\n\t\S+/errors_test\.go:\d+ \+0x[0-9a-f]+\n`+
+			`testing\.tRunner\(`,
+		string(tracer.StackTrace()))
+}
+
+func TestHandler_withHeaderWritten(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(context.Background(), cfgGiven, serviceGiven)
+	assert.Nil(t, err)
+
+	h := s.Handler(func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusAccepted)
+		return server.Unavailable("downstream failed", nil)
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// then
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestServer_withPanickingHandler(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(&output))
+	assert.Nil(t, err)
+	s.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	// when
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	assert.NotContains(t, rec.Body.String(), "boom")
+	assert.Contains(t, output.String(), "handler panicked: panic: boom")
+	assert.Regexp(t,
+		`stack="goroutine \d+ \[running\]:\\n\S+/server_test\.TestServer_withPanickingHandler\.func\d+`,
+		output.String())
+	assert.Contains(t, output.String(), "httpRequest.status=500")
+}
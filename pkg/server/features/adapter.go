@@ -0,0 +1,56 @@
+package features
+
+import (
+	"context"
+	"net/http"
+)
+
+// legacyAdapter wraps a LegacyFeatureProvider into a FeatureProvider.
+type legacyAdapter struct {
+	legacy LegacyFeatureProvider // the wrapped provider
+}
+
+// Adapt turns a LegacyFeatureProvider into a FeatureProvider.
+// The legacy calls cannot be cancelled: when the context is done first, the
+// adapter stops waiting and returns the context error while the legacy call
+// keeps running in the background.
+func Adapt(legacy LegacyFeatureProvider) FeatureProvider {
+	return &legacyAdapter{legacy: legacy}
+}
+
+// New calls the legacy New, waiting at most until the context is done.
+func (a *legacyAdapter) New(
+	ctx context.Context, serviceName string, onError func(err error)) error {
+
+	return wait(ctx, func() error {
+		return a.legacy.New(serviceName, onError)
+	})
+}
+
+// Close calls the legacy Close, waiting at most until the context is done.
+func (a *legacyAdapter) Close(ctx context.Context) error {
+	return wait(ctx, a.legacy.Close)
+}
+
+// Report calls the legacy Report. The context is ignored.
+func (a *legacyAdapter) Report(
+	_ context.Context, err error, req *http.Request) {
+
+	a.legacy.Report(err, req)
+}
+
+// wait runs fn in a goroutine and returns its error, or the context error if
+// the context is done first.
+func wait(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,88 @@
+package features_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// legacy feature provider
+type legacyProviderMock struct {
+	mock.Mock
+
+	delay time.Duration // how long New and Close block
+}
+
+func (m *legacyProviderMock) New(
+	serviceName string, onError func(err error)) error {
+
+	time.Sleep(m.delay)
+	args := m.Called(serviceName)
+	return args.Error(0)
+}
+
+func (m *legacyProviderMock) Close() error {
+	time.Sleep(m.delay)
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *legacyProviderMock) Report(err error, req *http.Request) {
+	m.Called(err)
+}
+
+func TestAdapt_New(t *testing.T) {
+	// given
+	legacyGiven := &legacyProviderMock{}
+	serviceGiven := "service-name"
+	errorGiven := fmt.Errorf("new failed")
+
+	// when
+	legacyGiven.On("New", serviceGiven).Return(errorGiven)
+	fp := features.Adapt(legacyGiven)
+	err := fp.New(context.Background(), serviceGiven, nil)
+
+	// then
+	assert.ErrorIs(t, err, errorGiven)
+	legacyGiven.AssertExpectations(t)
+}
+
+func TestAdapt_New_withDeadline(t *testing.T) {
+	// given
+	legacyGiven := &legacyProviderMock{delay: time.Second}
+	serviceGiven := "service-name"
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// when
+	legacyGiven.On("New", serviceGiven).Return(nil).Maybe()
+	fp := features.Adapt(legacyGiven)
+	err := fp.New(ctx, serviceGiven, nil)
+
+	// then
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestAdapt_CloseAndReport(t *testing.T) {
+	// given
+	legacyGiven := &legacyProviderMock{}
+	errorGiven := fmt.Errorf("reported error")
+
+	// when
+	legacyGiven.On("Close").Return(nil)
+	legacyGiven.On("Report", errorGiven).Return()
+	fp := features.Adapt(legacyGiven)
+	fp.Report(context.Background(), errorGiven, nil)
+	err := fp.Close(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	legacyGiven.AssertExpectations(t)
+}
@@ -0,0 +1,153 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/errorreporting"
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+)
+
+// The names of the features provided by this package.
+const (
+	MetadataName       = "metadata"
+	SecretManagerName  = "secret-manager"
+	ErrorReportingName = "error-reporting"
+	PublisherName      = "pubsub-publisher"
+	TasksName          = "cloud-tasks"
+	LogReporterName    = "log-reporter"
+)
+
+// DefaultFeatures returns the features of the default provider: the metadata
+// client, the secret manager, the error reporting and the Pub/Sub publisher.
+func DefaultFeatures() []Feature {
+	return []Feature{
+		new(MetadataFeature),
+		new(SecretManagerFeature),
+		new(ErrorReportingFeature),
+		new(PublisherFeature),
+	}
+}
+
+// MetadataFeature gives access to the Cloud project metadatas.
+type MetadataFeature struct {
+	Client    *metadata.Client // the client access the Cloud project metadatas
+	ProjectID string           // the current project identifier
+}
+
+// Name returns [MetadataName].
+func (f *MetadataFeature) Name() string { return MetadataName }
+
+// DependsOn returns no dependency.
+func (f *MetadataFeature) DependsOn() []string { return nil }
+
+// Start creates the metadata client and looks up the project identifier.
+// Transient metadata errors are retried until the context is done.
+func (f *MetadataFeature) Start(ctx context.Context, _ *Registry) error {
+
+	// the lookup is bound to the context to avoid hanging when the metadata
+	// server is unreachable
+	lookupClient := metadata.NewClient(&http.Client{
+		Transport: &contextTransport{
+			ctx:  ctx,
+			base: http.DefaultTransport,
+		},
+	})
+
+	var projectId string
+	err := retry(ctx, func() (err error) {
+		projectId, err = lookupClient.ProjectID()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("metadataClient.ProjectID: %v", err)
+	}
+
+	f.Client = metadata.NewClient(nil)
+	f.ProjectID = projectId
+	return nil
+}
+
+// Close does nothing, the metadata client holds no resource.
+func (f *MetadataFeature) Close(_ context.Context) error { return nil }
+
+// SecretManagerFeature gives access to the secrets.
+type SecretManagerFeature struct {
+	Client *secretmanager.Client // the client to access secrets
+}
+
+// Name returns [SecretManagerName].
+func (f *SecretManagerFeature) Name() string { return SecretManagerName }
+
+// DependsOn returns no dependency.
+func (f *SecretManagerFeature) DependsOn() []string { return nil }
+
+// Start creates the secret manager client.
+func (f *SecretManagerFeature) Start(ctx context.Context, _ *Registry) error {
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("secretmanager.NewClient: %v", err)
+	}
+
+	f.Client = client
+	return nil
+}
+
+// Close closes the secret manager client.
+func (f *SecretManagerFeature) Close(ctx context.Context) error {
+	return wait(ctx, f.Client.Close)
+}
+
+// ErrorReportingFeature reports errors to Error Reporting.
+type ErrorReportingFeature struct {
+	Client *errorreporting.Client // the client to report errors
+}
+
+// Name returns [ErrorReportingName].
+func (f *ErrorReportingFeature) Name() string { return ErrorReportingName }
+
+// DependsOn returns [MetadataName], the project identifier is required.
+func (f *ErrorReportingFeature) DependsOn() []string {
+	return []string{MetadataName}
+}
+
+// Start creates the error reporting client for the registry service and its
+// version.
+func (f *ErrorReportingFeature) Start(ctx context.Context, r *Registry) error {
+	metadataFeature, ok := Lookup[*MetadataFeature](r)
+	if !ok {
+		return fmt.Errorf("metadata feature not started")
+	}
+
+	client, err := errorreporting.NewClient(
+		ctx, metadataFeature.ProjectID, errorreporting.Config{
+			ServiceName:    r.ServiceName(),
+			ServiceVersion: r.ServiceVersion(),
+			OnError:        r.OnError,
+		})
+	if err != nil {
+		return fmt.Errorf("errorreporting.NewClient: %v", err)
+	}
+
+	f.Client = client
+	return nil
+}
+
+// Close flushes and closes the error reporting client.
+func (f *ErrorReportingFeature) Close(ctx context.Context) error {
+	return wait(ctx, f.Client.Close)
+}
+
+// Report reports the error using the error reporting client, along the
+// stack trace carried by the error, if any.
+func (f *ErrorReportingFeature) Report(
+	_ context.Context, err error, req *http.Request) {
+
+	f.Client.Report(errorreporting.Entry{
+		Error: err,
+		Req:   req,
+		Stack: stackOf(err),
+	})
+}
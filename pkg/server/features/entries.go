@@ -0,0 +1,104 @@
+package features
+
+import "github.com/planetfall/framework/pkg/config"
+
+// The Pub/Sub publisher config entries.
+var (
+	PublisherProjectEntry = config.Entry{
+		Flag:         "pubsub-project",
+		DefaultValue: "",
+		Description:  "the Pub/Sub project, defaults to the current project",
+		EnvKey:       "PUBSUB_PROJECT_ID",
+	}
+
+	PublisherBatchCountEntry = config.Entry{
+		Flag:         "pubsub-batch-count",
+		DefaultValue: "100",
+		Description:  "the number of messages sent in a Pub/Sub batch",
+		EnvKey:       "PUBSUB_BATCH_COUNT",
+	}
+
+	PublisherBatchBytesEntry = config.Entry{
+		Flag:         "pubsub-batch-bytes",
+		DefaultValue: "1000000",
+		Description:  "the size in bytes of a Pub/Sub batch",
+		EnvKey:       "PUBSUB_BATCH_BYTES",
+	}
+
+	PublisherBatchDelayEntry = config.Entry{
+		Flag:         "pubsub-batch-delay",
+		DefaultValue: "10ms",
+		Description:  "the maximum delay before sending a Pub/Sub batch",
+		EnvKey:       "PUBSUB_BATCH_DELAY",
+	}
+)
+
+// The Cloud Tasks config entries.
+var (
+	TasksLocationEntry = config.Entry{
+		Flag:         "tasks-location",
+		DefaultValue: "europe-west1",
+		Description:  "the location of the Cloud Tasks queues",
+		EnvKey:       "TASKS_LOCATION",
+	}
+
+	TasksServiceURLEntry = config.Entry{
+		Flag:         "tasks-service-url",
+		DefaultValue: "",
+		Description:  "the base URL of the service called by the tasks",
+		EnvKey:       "TASKS_SERVICE_URL",
+	}
+
+	TasksServiceAccountEntry = config.Entry{
+		Flag:         "tasks-service-account",
+		DefaultValue: "",
+		Description:  "the service account of the tasks OIDC token, required with Cloud Tasks",
+		EnvKey:       "TASKS_SERVICE_ACCOUNT",
+	}
+)
+
+// FeaturePoliciesEntry is the config entry of the features policies, as a
+// list of name=policy, such as
+// "error-reporting=optional,pubsub-publisher=lazy". The features not listed
+// are required, see [Policy].
+var FeaturePoliciesEntry = config.Entry{
+	Flag:         "feature-policies",
+	DefaultValue: "",
+	Description:  "the features policies, as name=required|optional|lazy",
+	EnvKey:       "FEATURE_POLICIES",
+}
+
+// ReporterEntry is the config entry of the feature reporting the errors:
+// either [ErrorReportingName], using the Error Reporting API, or
+// [LogReporterName], writing the errors to the log stream.
+var ReporterEntry = config.Entry{
+	Flag:         "reporter",
+	DefaultValue: ErrorReportingName,
+	Description:  "the errors reporter, error-reporting or log-reporter",
+	EnvKey:       "REPORTER",
+}
+
+// ReportQueueSizeEntry is the config entry of the number of error reports
+// queued before new reports are dropped, see [ReportQueue].
+var ReportQueueSizeEntry = config.Entry{
+	Flag:         "report-queue-size",
+	DefaultValue: "1000",
+	Description:  "the number of error reports queued before dropping them",
+	EnvKey:       "REPORT_QUEUE_SIZE",
+}
+
+// Entries returns the config entries read by the features.
+func Entries() []config.Entry {
+	return []config.Entry{
+		PublisherProjectEntry,
+		PublisherBatchCountEntry,
+		PublisherBatchBytesEntry,
+		PublisherBatchDelayEntry,
+		TasksLocationEntry,
+		TasksServiceURLEntry,
+		TasksServiceAccountEntry,
+		FeaturePoliciesEntry,
+		ReporterEntry,
+		ReportQueueSizeEntry,
+	}
+}
@@ -5,12 +5,33 @@
 package features
 
 import (
+	"context"
 	"net/http"
 )
 
 // FeatureProvider provides specific cloud features.
 // If manages the instanciation and closing the features.
+//
+// Every method takes a context: implementations must give up and return once
+// the context is done, so a slow or unreachable cloud backend can never block
+// the server forever.
 type FeatureProvider interface {
+	New(ctx context.Context, serviceName string, onError func(err error)) error
+	Close(ctx context.Context) error
+
+	Report(ctx context.Context, err error, req *http.Request)
+}
+
+// ServiceVersionSetter is implemented by the feature providers reporting the
+// service version, such as [FeatureProviderImpl]. The server sets the version
+// before calling New.
+type ServiceVersionSetter interface {
+	SetServiceVersion(version string)
+}
+
+// LegacyFeatureProvider is the former, context-less, revision of
+// FeatureProvider. Use [Adapt] to turn it into a FeatureProvider.
+type LegacyFeatureProvider interface {
 	New(serviceName string, onError func(err error)) error
 	Close() error
 
@@ -2,72 +2,123 @@ package features
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
-
-	"cloud.google.com/go/compute/metadata"
-	"cloud.google.com/go/errorreporting"
-	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"strconv"
 )
 
+// FeatureProviderImpl is the default feature provider. It is backed by a
+// Registry holding the [DefaultFeatures] and any user-defined feature.
+// The zero value is ready to use.
 type FeatureProviderImpl struct {
-	metadataClient *metadata.Client       // the client access the Cloud project metadatas
-	secretManager  *secretmanager.Client  // the client to access secrets
-	errorReporting *errorreporting.Client // the client to report errors
+	registry Registry     // the features of the provider
+	queue    *ReportQueue // the queued reports, once started
+}
+
+// Register adds user-defined features to the provider. It must be called
+// before New. A feature named after a default feature replaces it.
+func (f *FeatureProviderImpl) Register(features ...Feature) error {
+	return f.registry.Register(features...)
+}
+
+// Disable prevents the named feature, either default or user-defined, from
+// being started. It must be called before New.
+func (f *FeatureProviderImpl) Disable(name string) {
+	f.registry.Disable(name)
+}
+
+// SetServiceVersion sets the version of the service, reported along the
+// errors. It must be called before New.
+func (f *FeatureProviderImpl) SetServiceVersion(version string) {
+	f.registry.SetServiceVersion(version)
+}
+
+// Registry returns the registry holding the provider features.
+func (f *FeatureProviderImpl) Registry() *Registry {
+	return &f.registry
 }
 
-// New initialize the provider features
+// New initialize the provider features in dependency order, following the
+// policies set by [FeaturePoliciesEntry] or [Registry.SetPolicy]. The errors
+// are reported by the feature selected by [ReporterEntry].
 func (f *FeatureProviderImpl) New(
-	serviceName string, onError func(err error)) error {
+	ctx context.Context, serviceName string, onError func(err error)) error {
 
-	ctx := context.Background()
+	if err := f.registry.setPolicies(); err != nil {
+		return fmt.Errorf("registry.setPolicies: %v", err)
+	}
 
-	// metadata client
-	metadataClient := metadata.NewClient(nil)
-	projectId, err := metadataClient.ProjectID()
-	if err != nil {
-		return fmt.Errorf("metadataClient.ProjectID: %v", err)
+	switch reporter := ReporterEntry.Value(); reporter {
+	case ErrorReportingName:
+	case LogReporterName:
+		f.registry.Disable(ErrorReportingName)
+		if f.registry.get(LogReporterName) == nil {
+			if err := f.registry.Register(new(LogReporterFeature)); err != nil {
+				return fmt.Errorf("registry.Register: %v", err)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid %s value %q", ReporterEntry.Flag, reporter)
 	}
 
-	// secret manager
-	secretManager, err := secretmanager.NewClient(ctx)
-	if err != nil {
-		return fmt.Errorf("secretmanager.NewClient: %v", err)
+	queueSize, err := strconv.Atoi(ReportQueueSizeEntry.Value())
+	if err != nil || queueSize <= 0 {
+		return fmt.Errorf("invalid %s value %q",
+			ReportQueueSizeEntry.Flag, ReportQueueSizeEntry.Value())
 	}
 
-	// error reporting
-	errorReporting, err := errorreporting.NewClient(
-		ctx, projectId, errorreporting.Config{
-			ServiceName: serviceName,
-			OnError:     onError,
-		})
-	if err != nil {
-		return fmt.Errorf("errorreporting.NewClient: %v", err)
+	for _, feature := range DefaultFeatures() {
+		if f.registry.get(feature.Name()) != nil {
+			continue
+		}
+
+		if err := f.registry.Register(feature); err != nil {
+			return fmt.Errorf("registry.Register: %v", err)
+		}
 	}
 
-	// set the feature in the provider
-	f.metadataClient = metadataClient
-	f.errorReporting = errorReporting
-	f.secretManager = secretManager
+	if err := f.registry.Start(ctx, serviceName, onError); err != nil {
+		return fmt.Errorf("registry.Start: %v", err)
+	}
 
+	f.queue = NewReportQueue(registryReporter{&f.registry}, queueSize)
 	return nil
 }
 
-func (f *FeatureProviderImpl) Close() error {
-	if err := f.secretManager.Close(); err != nil {
-		return fmt.Errorf("secretManager.Close: %v", err)
+// Close sends the queued reports, then closes the provider features in
+// reverse order, waiting at most until the context is done.
+func (f *FeatureProviderImpl) Close(ctx context.Context) error {
+	var errs []error
+	if f.queue != nil {
+		if err := f.queue.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("queue.Close: %w", err))
+		}
 	}
 
-	if err := f.errorReporting.Close(); err != nil {
-		return fmt.Errorf("errorReporting.Close: %v", err)
+	if err := f.registry.Close(ctx); err != nil {
+		errs = append(errs, err)
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// Report reports the error using the first feature able to report. Once the
+// provider is started, the reports are queued and sent asynchronously, see
+// [ReportQueueSizeEntry].
+func (f *FeatureProviderImpl) Report(
+	ctx context.Context, err error, req *http.Request) {
+
+	if f.queue != nil {
+		f.queue.Report(ctx, err, req)
+		return
+	}
+
+	registryReporter{&f.registry}.Report(ctx, err, req)
 }
 
-func (f *FeatureProviderImpl) Report(err error, req *http.Request) {
-	f.errorReporting.Report(errorreporting.Entry{
-		Error: err,
-		Req:   req,
-	})
+// ReportQueue returns the queue of the reports, or nil until the provider is
+// started.
+func (f *FeatureProviderImpl) ReportQueue() *ReportQueue {
+	return f.queue
 }
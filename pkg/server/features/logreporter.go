@@ -0,0 +1,155 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/correlation"
+)
+
+// reportedErrorEventType marks the log entries Error Reporting ingests as
+// errors, whatever their message.
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// LogReporterFeature reports errors as structured log entries in the
+// ReportedErrorEvent format, which Cloud Logging forwards to Error Reporting.
+// Unlike [ErrorReportingFeature], it requires no API access, only the log
+// stream. It is selected by the [ReporterEntry] entry.
+type LogReporterFeature struct {
+	Writer io.Writer // the log stream, defaults to the standard output
+
+	mu       sync.Mutex // guards the writes
+	registry *Registry  // the registry holding the metadata feature, if any
+}
+
+// Name returns [LogReporterName].
+func (f *LogReporterFeature) Name() string { return LogReporterName }
+
+// DependsOn returns no dependency: the entries are only bound to the traces
+// when the metadata feature is started.
+func (f *LogReporterFeature) DependsOn() []string { return nil }
+
+// Start defaults the writer to the standard output.
+func (f *LogReporterFeature) Start(_ context.Context, r *Registry) error {
+	if f.Writer == nil {
+		f.Writer = os.Stdout
+	}
+
+	f.registry = r
+	return nil
+}
+
+// Close does nothing, the entries are written synchronously.
+func (f *LogReporterFeature) Close(_ context.Context) error { return nil }
+
+// reportedErrorEvent is a log entry in the ReportedErrorEvent format.
+type reportedErrorEvent struct {
+	Type           string         `json:"@type"`
+	Severity       string         `json:"severity"`
+	EventTime      string         `json:"eventTime"`
+	Message        string         `json:"message"`
+	ServiceContext serviceContext `json:"serviceContext"`
+	Context        *errorContext  `json:"context,omitempty"`
+	RequestID      string         `json:"requestId,omitempty"`
+	Trace          string         `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID         string         `json:"logging.googleapis.com/spanId,omitempty"`
+}
+
+// serviceContext identifies the service reporting the error.
+type serviceContext struct {
+	Service string `json:"service"`
+	Version string `json:"version,omitempty"`
+}
+
+// errorContext describes the request that failed.
+type errorContext struct {
+	HTTPRequest httpRequestContext `json:"httpRequest"`
+}
+
+// httpRequestContext describes an HTTP request, as Error Reporting does.
+type httpRequestContext struct {
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	UserAgent string `json:"userAgent,omitempty"`
+	Referrer  string `json:"referrer,omitempty"`
+	RemoteIP  string `json:"remoteIp,omitempty"`
+}
+
+// Report writes the error as a log entry. The message holds the stack trace
+// carried by the error, or else the stack of the caller, as Error Reporting
+// groups the errors by stack trace. It follows the layout of the Go panics:
+// the error message, a blank line, then the goroutine stack.
+func (f *LogReporterFeature) Report(
+	ctx context.Context, err error, req *http.Request) {
+
+	stack := stackOf(err)
+	if stack == nil {
+		stack = callerStack()
+	}
+
+	event := reportedErrorEvent{
+		Type:      reportedErrorEventType,
+		Severity:  "ERROR",
+		EventTime: time.Now().UTC().Format(time.RFC3339Nano),
+		Message:   err.Error() + "\n\n" + string(stack),
+		ServiceContext: serviceContext{
+			Service: f.registry.ServiceName(),
+			Version: f.registry.ServiceVersion(),
+		},
+	}
+
+	if req != nil {
+		event.Context = &errorContext{HTTPRequest: httpRequestContext{
+			Method:    req.Method,
+			URL:       req.Host + req.RequestURI,
+			UserAgent: req.UserAgent(),
+			Referrer:  req.Referer(),
+			RemoteIP:  remoteIP(req),
+		}}
+	}
+
+	if ids, ok := correlation.FromContext(ctx); ok {
+		event.RequestID = ids.RequestID
+		if metadataFeature, ok := Lookup[*MetadataFeature](f.registry); ok &&
+			ids.TraceID != "" {
+
+			event.Trace = "projects/" + metadataFeature.ProjectID +
+				"/traces/" + ids.TraceID
+			event.SpanID = ids.SpanID
+		}
+	}
+
+	entry, errMarshal := json.Marshal(event)
+	if errMarshal != nil {
+		f.registry.OnError(errMarshal)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, errWrite := f.Writer.Write(append(entry, '\n')); errWrite != nil {
+		f.registry.OnError(errWrite)
+	}
+}
+
+// remoteIP returns the client address resolved by the server, or the host of
+// the peer address.
+func remoteIP(req *http.Request) string {
+	if ip, ok := correlation.ClientIPFromContext(req.Context()); ok {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
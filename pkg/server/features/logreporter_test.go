@@ -0,0 +1,136 @@
+package features_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/server/correlation"
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogReporterFeature_Report(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	r, err := features.NewRegistry(&features.LogReporterFeature{Writer: &output})
+	assert.Nil(t, err)
+	r.SetServiceVersion("v1.2.3")
+	assert.Nil(t, r.Start(context.Background(), "service-name", nil))
+
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{
+		RequestID: "request-id",
+		TraceID:   "trace-id",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", nil)
+	req.Header.Set("User-Agent", "agent-given")
+
+	// when
+	reporter, ok := features.Lookup[features.Reporter](r)
+	reporter.Report(ctx, errors.New("order failed"), req)
+
+	var event map[string]any
+	errDecode := json.Unmarshal(output.Bytes(), &event)
+
+	// then
+	assert.True(t, ok)
+	assert.Nil(t, errDecode)
+	assert.Equal(t,
+		"type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent",
+		event["@type"])
+	assert.Equal(t, "ERROR", event["severity"])
+	assert.NotEmpty(t, event["eventTime"])
+	assert.Equal(t, map[string]any{
+		"service": "service-name",
+		"version": "v1.2.3",
+	}, event["serviceContext"])
+	assert.Equal(t, map[string]any{"httpRequest": map[string]any{
+		"method":    "POST",
+		"url":       "example.com/orders?id=1",
+		"userAgent": "agent-given",
+		"remoteIp":  "192.0.2.1",
+	}}, event["context"])
+	assert.Equal(t, "request-id", event["requestId"])
+	assert.NotContains(t, event, "logging.googleapis.com/trace")
+
+	message := event["message"].(string)
+	assert.Regexp(t, `^order failed\n\ngoroutine \d+ \[running\]:\n`, message)
+	assert.Contains(t, message, "features_test.TestLogReporterFeature_Report(...)")
+	assert.NotContains(t, message, "features.callerStack")
+}
+
+func TestLogReporterFeature_Report_withStack(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	r, err := features.NewRegistry(&features.LogReporterFeature{Writer: &output})
+	assert.Nil(t, err)
+	assert.Nil(t, r.Start(context.Background(), "service-name", nil))
+
+	errGiven := raiseFromHelper()
+
+	// when
+	reporter, _ := features.Lookup[features.Reporter](r)
+	reporter.Report(context.Background(), errGiven, nil)
+
+	var event map[string]any
+	errDecode := json.Unmarshal(output.Bytes(), &event)
+
+	// then
+	assert.Nil(t, errDecode)
+	assert.NotContains(t, event, "context")
+	assert.NotContains(t, event["serviceContext"], "version")
+	assert.Contains(t, event["message"], "features_test.raiseFromHelper(...)")
+}
+
+func raiseFromHelper() error {
+	return features.WithStack(errors.New("helper failed"))
+}
+
+func TestLogReporterFeature_Report_withClientIP(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	r, err := features.NewRegistry(&features.LogReporterFeature{Writer: &output})
+	assert.Nil(t, err)
+	assert.Nil(t, r.Start(context.Background(), "service-name", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req = req.WithContext(
+		correlation.NewClientIPContext(req.Context(), "203.0.113.7"))
+
+	// when
+	reporter, _ := features.Lookup[features.Reporter](r)
+	reporter.Report(req.Context(), errors.New("order failed"), req)
+
+	var event struct {
+		Context struct {
+			HTTPRequest struct {
+				RemoteIP string `json:"remoteIp"`
+			} `json:"httpRequest"`
+		} `json:"context"`
+	}
+	errDecode := json.Unmarshal(output.Bytes(), &event)
+
+	// then
+	assert.Nil(t, errDecode)
+	assert.Equal(t, "203.0.113.7", event.Context.HTTPRequest.RemoteIP)
+}
+
+func TestFeatureProviderImpl_New_invalidReporter_shouldFail(t *testing.T) {
+	// given
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set(features.ReporterEntry.Flag, "stderr")
+
+	// when
+	err := new(features.FeatureProviderImpl).New(
+		context.Background(), "service-name", nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid reporter value")
+}
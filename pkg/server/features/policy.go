@@ -0,0 +1,237 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The default pauses between two background start attempts.
+const (
+	defaultRetryMin = time.Second
+	defaultRetryMax = time.Minute
+)
+
+// Policy says how the registry handles a feature that cannot start.
+type Policy int
+
+// The feature policies.
+const (
+	// Required features must start: the registry fails to start otherwise.
+	Required Policy = iota
+	// Optional features are started with the registry. If they fail, the
+	// registry starts without them and retries in the background.
+	Optional
+	// Lazy features are only started in the background, so they never
+	// delay the registry start.
+	Lazy
+)
+
+// String returns the policy name, as parsed by [ParsePolicy].
+func (p Policy) String() string {
+	switch p {
+	case Required:
+		return "required"
+	case Optional:
+		return "optional"
+	case Lazy:
+		return "lazy"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// ParsePolicy returns the policy named "required", "optional" or "lazy".
+func ParsePolicy(name string) (Policy, error) {
+	for _, policy := range []Policy{Required, Optional, Lazy} {
+		if strings.EqualFold(name, policy.String()) {
+			return policy, nil
+		}
+	}
+
+	return Required, fmt.Errorf("unknown policy %q", name)
+}
+
+// DegradedError is given to the registry error callback when a feature that
+// is not required fails to start. The registry keeps running without it,
+// and retries to start it in the background.
+type DegradedError struct {
+	Feature string // the feature name
+	Err     error  // the start error
+}
+
+// Error returns the feature and its start error.
+func (e *DegradedError) Error() string {
+	return fmt.Sprintf("feature %s degraded: %v", e.Feature, e.Err)
+}
+
+// Unwrap returns the start error.
+func (e *DegradedError) Unwrap() error {
+	return e.Err
+}
+
+// SetPolicy sets the policy of the named feature. The features are required
+// unless set otherwise. It must be called before Start.
+func (r *Registry) SetPolicy(name string, policy Policy) {
+	if r.policies == nil {
+		r.policies = make(map[string]Policy)
+	}
+
+	r.policies[name] = policy
+}
+
+// SetRetryBackoff sets the pauses between two background start attempts:
+// the pause starts at min and doubles up to max. It defaults to a second up
+// to a minute. It must be called before Start.
+func (r *Registry) SetRetryBackoff(min, max time.Duration) {
+	r.retryMin = min
+	r.retryMax = max
+}
+
+// setPolicies sets the policies configured by [FeaturePoliciesEntry].
+func (r *Registry) setPolicies() error {
+	for _, value := range FeaturePoliciesEntry.Values() {
+		name, policyName, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("invalid %s value %q",
+				FeaturePoliciesEntry.Flag, value)
+		}
+
+		policy, err := ParsePolicy(strings.TrimSpace(policyName))
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %v",
+				FeaturePoliciesEntry.Flag, value, err)
+		}
+
+		r.SetPolicy(strings.TrimSpace(name), policy)
+	}
+
+	return nil
+}
+
+// startPending starts the pending features in the background, in dependency
+// order, until they are all started or the context is done.
+func (r *Registry) startPending(ctx context.Context, pending []Feature) {
+	defer close(r.pendingDone)
+
+	backoff := r.retryMin
+	if backoff <= 0 {
+		backoff = defaultRetryMin
+	}
+	maxBackoff := r.retryMax
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMax
+	}
+
+	// the features that failed with the registry are not retried at once
+	for first := true; ; first = false {
+		remaining := pending[:0:0]
+		for _, feature := range pending {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if !r.dependenciesStarted(feature) ||
+				(first && r.pendingErr(feature.Name()) != nil) {
+
+				remaining = append(remaining, feature)
+				continue
+			}
+
+			if err := feature.Start(ctx, r); err != nil {
+				err = fmt.Errorf("%s.Start: %w", feature.Name(), err)
+				r.setPendingErr(feature.Name(), err)
+				r.OnError(&DegradedError{Feature: feature.Name(), Err: err})
+				remaining = append(remaining, feature)
+				continue
+			}
+
+			// the registry closed during the start, the feature is closed
+			// here as it would never be otherwise
+			if !r.addPendingStarted(ctx, feature) {
+				r.closeLate(ctx, feature)
+				return
+			}
+		}
+
+		if pending = remaining; len(pending) == 0 {
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff = min(2*backoff, maxBackoff)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dependenciesStarted says if the dependencies of the feature are started.
+func (r *Registry) dependenciesStarted(feature Feature) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, name := range feature.DependsOn() {
+		if _, ok := r.pending[name]; ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pendingErr returns the last start error of the pending feature, if any.
+func (r *Registry) pendingErr(name string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.pending[name]
+}
+
+// addStarted records a started feature.
+func (r *Registry) addStarted(feature Feature) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.pending, feature.Name())
+	r.started = append(r.started, feature)
+}
+
+// addPendingStarted records a feature started in the background, unless the
+// context is done, the registry closing. It says if the feature was
+// recorded.
+func (r *Registry) addPendingStarted(ctx context.Context, feature Feature) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Close cancels the context before taking the started features
+	if ctx.Err() != nil {
+		return false
+	}
+
+	delete(r.pending, feature.Name())
+	r.started = append(r.started, feature)
+	return true
+}
+
+// closeLate closes a feature started once the registry is closing. The
+// context values are kept, but not its cancellation.
+func (r *Registry) closeLate(ctx context.Context, feature Feature) {
+	if err := feature.Close(context.WithoutCancel(ctx)); err != nil {
+		r.OnError(fmt.Errorf("%s.Close: %w", feature.Name(), err))
+	}
+}
+
+// setPendingErr records a pending feature, along with its last start error.
+func (r *Registry) setPendingErr(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending == nil {
+		r.pending = make(map[string]error)
+	}
+
+	r.pending[name] = err
+}
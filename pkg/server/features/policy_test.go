@@ -0,0 +1,257 @@
+package features_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// feature failing to start a given number of times
+type flakyFeature struct {
+	name      string
+	dependsOn []string
+	failures  int
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (f *flakyFeature) Name() string        { return f.name }
+func (f *flakyFeature) DependsOn() []string { return f.dependsOn }
+
+func (f *flakyFeature) Start(_ context.Context, _ *features.Registry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts++
+	if f.attempts <= f.failures {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
+func (f *flakyFeature) Close(_ context.Context) error { return nil }
+
+func (f *flakyFeature) Attempts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.attempts
+}
+
+// errors given to the registry callback
+type errorsRecorder struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (e *errorsRecorder) onError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.errs = append(e.errs, err)
+}
+
+func (e *errorsRecorder) Errors() []error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]error(nil), e.errs...)
+}
+
+func TestRegistry_Start_optional(t *testing.T) {
+	// given
+	metadata := &flakyFeature{name: "metadata", failures: 2}
+	reporting := &flakyFeature{name: "reporting", dependsOn: []string{"metadata"}}
+	r, err := features.NewRegistry(metadata, reporting)
+	assert.Nil(t, err)
+
+	r.SetPolicy("metadata", features.Optional)
+	r.SetPolicy("reporting", features.Optional)
+	r.SetRetryBackoff(time.Millisecond, 5*time.Millisecond)
+
+	var recorder errorsRecorder
+
+	// when
+	errStart := r.Start(context.Background(), "service-name", recorder.onError)
+	_, okBefore := features.Lookup[*flakyFeature](r)
+	statusBefore := r.Status()
+
+	// then
+	assert.Nil(t, errStart)
+	assert.False(t, okBefore)
+	assert.Equal(t, features.StatePending, statusBefore[0].State)
+	assert.Contains(t, statusBefore[0].Error, "unreachable")
+	assert.Equal(t, "optional", statusBefore[0].Policy)
+	assert.Equal(t, features.StatePending, statusBefore[1].State)
+
+	assert.Eventually(t, func() bool {
+		status := r.Status()
+		return status[0].State == features.StateStarted &&
+			status[1].State == features.StateStarted
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(t, 3, metadata.Attempts())
+	assert.Equal(t, 1, reporting.Attempts())
+
+	errs := recorder.Errors()
+	assert.Len(t, errs, 2)
+	var degradedErr *features.DegradedError
+	assert.ErrorAs(t, errs[0], &degradedErr)
+	assert.Equal(t, "metadata", degradedErr.Feature)
+
+	assert.Nil(t, r.Close(context.Background()))
+}
+
+func TestRegistry_Start_lazy(t *testing.T) {
+	// given
+	lazy := &flakyFeature{name: "publisher"}
+	r, err := features.NewRegistry(lazy)
+	assert.Nil(t, err)
+	r.SetPolicy("publisher", features.Lazy)
+
+	// when
+	errStart := r.Start(context.Background(), "service-name", nil)
+
+	// then
+	assert.Nil(t, errStart)
+	assert.Eventually(t, func() bool {
+		_, ok := features.Lookup[*flakyFeature](r)
+		return ok
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 1, lazy.Attempts())
+	assert.Nil(t, r.Close(context.Background()))
+}
+
+func TestRegistry_Start_requiredDependsOnOptional_shouldFail(t *testing.T) {
+	// given
+	r, err := features.NewRegistry(
+		&flakyFeature{name: "metadata", failures: 1},
+		&flakyFeature{name: "reporting", dependsOn: []string{"metadata"}},
+	)
+	assert.Nil(t, err)
+	r.SetPolicy("metadata", features.Optional)
+
+	// when
+	err = r.Start(context.Background(), "service-name", nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "feature reporting depends on features not started")
+}
+
+func TestRegistry_Close_shouldStopRetries(t *testing.T) {
+	// given
+	unreachable := &flakyFeature{name: "metadata", failures: 1000}
+	r, err := features.NewRegistry(unreachable)
+	assert.Nil(t, err)
+	r.SetPolicy("metadata", features.Optional)
+	r.SetRetryBackoff(time.Millisecond, time.Millisecond)
+
+	assert.Nil(t, r.Start(context.Background(), "service-name", nil))
+	assert.Eventually(t, func() bool {
+		return unreachable.Attempts() > 2
+	}, time.Second, time.Millisecond)
+
+	// when
+	errClose := r.Close(context.Background())
+	attempts := unreachable.Attempts()
+	time.Sleep(10 * time.Millisecond)
+
+	// then
+	assert.Nil(t, errClose)
+	assert.Equal(t, attempts, unreachable.Attempts())
+	assert.Empty(t, r.Status()[0].Error)
+}
+
+// feature starting once released, whatever its context
+type slowFeature struct {
+	starting chan struct{}
+	release  chan struct{}
+	closed   chan struct{}
+}
+
+func (f *slowFeature) Name() string        { return "slow" }
+func (f *slowFeature) DependsOn() []string { return nil }
+
+func (f *slowFeature) Start(_ context.Context, _ *features.Registry) error {
+	close(f.starting)
+	<-f.release
+	return nil
+}
+
+func (f *slowFeature) Close(_ context.Context) error {
+	close(f.closed)
+	return nil
+}
+
+func TestRegistry_Close_duringBackgroundStart(t *testing.T) {
+	// given
+	slow := &slowFeature{
+		starting: make(chan struct{}),
+		release:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	r, err := features.NewRegistry(slow)
+	assert.Nil(t, err)
+	r.SetPolicy("slow", features.Lazy)
+
+	assert.Nil(t, r.Start(context.Background(), "service-name", nil))
+	<-slow.starting
+
+	// when
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	errClose := r.Close(ctx)
+	close(slow.release)
+
+	// then, the feature started late is closed rather than registered
+	assert.ErrorIs(t, errClose, context.DeadlineExceeded)
+	assert.Eventually(t, func() bool {
+		select {
+		case <-slow.closed:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	_, ok := features.Lookup[*slowFeature](r)
+	assert.False(t, ok)
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, policy := range []features.Policy{
+		features.Required, features.Optional, features.Lazy} {
+
+		// when
+		parsed, err := features.ParsePolicy(policy.String())
+
+		// then
+		assert.Nil(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+
+	_, err := features.ParsePolicy("sometimes")
+	assert.NotNil(t, err)
+}
+
+func TestFeatureProviderImpl_New_invalidPolicies_shouldFail(t *testing.T) {
+	// given
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set(features.FeaturePoliciesEntry.Flag, "metadata=sometimes")
+
+	// when
+	err := new(features.FeatureProviderImpl).New(
+		context.Background(), "service-name", nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "feature-policies")
+}
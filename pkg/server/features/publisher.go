@@ -0,0 +1,169 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/planetfall/framework/pkg/server/correlation"
+)
+
+// emulatorHostEnv is the environment variable set to use the Pub/Sub
+// emulator. The Pub/Sub client connects to it automatically.
+const emulatorHostEnv = "PUBSUB_EMULATOR_HOST"
+
+// emulatorProjectID is the project used with the emulator when none is set.
+const emulatorProjectID = "emulator-project"
+
+// The message attributes holding the trace context.
+const (
+	traceParentAttribute = "traceparent"
+	requestIDAttribute   = "x-request-id"
+)
+
+// PublisherFeature publishes messages to Pub/Sub topics.
+//
+// The project is set by the [PublisherProjectEntry] config entry, and
+// defaults to the current project. When the PUBSUB_EMULATOR_HOST
+// environment variable is set, the emulator is used instead of Pub/Sub.
+type PublisherFeature struct {
+	Client *pubsub.Client // the Pub/Sub client
+
+	settings pubsub.PublishSettings   // the batching settings of the topics
+	mu       sync.Mutex               // guards topics
+	topics   map[string]*pubsub.Topic // the topic handles by name
+}
+
+// Name returns [PublisherName].
+func (f *PublisherFeature) Name() string { return PublisherName }
+
+// DependsOn returns [MetadataName], unless the project is known without it.
+func (f *PublisherFeature) DependsOn() []string {
+	if PublisherProjectEntry.Value() != "" || os.Getenv(emulatorHostEnv) != "" {
+		return nil
+	}
+
+	return []string{MetadataName}
+}
+
+// Start creates the Pub/Sub client, with the batching settings from the
+// config entries.
+func (f *PublisherFeature) Start(ctx context.Context, r *Registry) error {
+	settings, err := publishSettings()
+	if err != nil {
+		return fmt.Errorf("publishSettings: %v", err)
+	}
+
+	projectID := PublisherProjectEntry.Value()
+	if projectID == "" {
+		if metadataFeature, ok := Lookup[*MetadataFeature](r); ok {
+			projectID = metadataFeature.ProjectID
+		} else {
+			projectID = emulatorProjectID
+		}
+	}
+
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return fmt.Errorf("pubsub.NewClient: %v", err)
+	}
+
+	f.Client = client
+	f.settings = settings
+	f.topics = make(map[string]*pubsub.Topic)
+	return nil
+}
+
+// Topic returns the handle of the named topic. The handles are cached, so
+// their batches are shared by all the publishers of the topic.
+func (f *PublisherFeature) Topic(name string) *pubsub.Topic {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	topic, ok := f.topics[name]
+	if !ok {
+		topic = f.Client.Topic(name)
+		topic.PublishSettings = f.settings
+		f.topics[name] = topic
+	}
+
+	return topic
+}
+
+// Publish publishes the message to the named topic. The correlation
+// identifiers stored in the context are added to the message attributes,
+// unless already set. The attributes are copied, so the map given by the
+// caller is left unchanged.
+func (f *PublisherFeature) Publish(
+	ctx context.Context, topic string, msg *pubsub.Message) *pubsub.PublishResult {
+
+	if ids, ok := correlation.FromContext(ctx); ok {
+		attributes := make(map[string]string, len(msg.Attributes)+2)
+		for key, value := range msg.Attributes {
+			attributes[key] = value
+		}
+
+		setDefault(attributes, requestIDAttribute, ids.RequestID)
+		setDefault(attributes, traceParentAttribute, ids.TraceParent())
+		msg.Attributes = attributes
+	}
+
+	return f.Topic(topic).Publish(ctx, msg)
+}
+
+// Close flushes the pending messages of all the topics and closes the client.
+func (f *PublisherFeature) Close(ctx context.Context) error {
+	return wait(ctx, func() error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		for _, topic := range f.topics {
+			topic.Stop()
+		}
+
+		return f.Client.Close()
+	})
+}
+
+// setDefault sets the value of the key, unless the key is already set or the
+// value is empty.
+func setDefault(attributes map[string]string, key, value string) {
+	if _, ok := attributes[key]; ok || value == "" {
+		return
+	}
+
+	attributes[key] = value
+}
+
+// publishSettings returns the default publish settings overridden by the
+// batching config entries.
+func publishSettings() (pubsub.PublishSettings, error) {
+	settings := pubsub.DefaultPublishSettings
+
+	count, err := strconv.Atoi(PublisherBatchCountEntry.Value())
+	if err != nil {
+		return settings, fmt.Errorf("invalid %s: %v",
+			PublisherBatchCountEntry.Flag, err)
+	}
+
+	bytes, err := strconv.Atoi(PublisherBatchBytesEntry.Value())
+	if err != nil {
+		return settings, fmt.Errorf("invalid %s: %v",
+			PublisherBatchBytesEntry.Flag, err)
+	}
+
+	delay, err := time.ParseDuration(PublisherBatchDelayEntry.Value())
+	if err != nil {
+		return settings, fmt.Errorf("invalid %s: %v",
+			PublisherBatchDelayEntry.Flag, err)
+	}
+
+	settings.CountThreshold = count
+	settings.ByteThreshold = bytes
+	settings.DelayThreshold = delay
+	return settings, nil
+}
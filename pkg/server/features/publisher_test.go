@@ -0,0 +1,82 @@
+package features_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/planetfall/framework/pkg/server/correlation"
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublisherFeature_withEmulator(t *testing.T) {
+	// given
+	srv := pstest.NewServer()
+	defer srv.Close()
+	t.Setenv("PUBSUB_EMULATOR_HOST", srv.Addr)
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set(features.PublisherBatchCountEntry.Flag, "10")
+
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{
+		RequestID: "request-id",
+		TraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:    "00f067aa0ba902b7",
+	})
+
+	r, err := features.NewRegistry(new(features.PublisherFeature))
+	assert.Nil(t, err)
+
+	// when
+	err = r.Start(context.Background(), "service-name", nil)
+	assert.Nil(t, err)
+
+	publisher, ok := features.Lookup[*features.PublisherFeature](r)
+	assert.True(t, ok)
+	assert.Empty(t, publisher.DependsOn())
+
+	_, err = publisher.Client.CreateTopic(ctx, "topic")
+	assert.Nil(t, err)
+
+	attributesGiven := map[string]string{"x-request-id": "kept"}
+	publisher.Publish(ctx, "topic", &pubsub.Message{
+		Data:       []byte("hello"),
+		Attributes: attributesGiven,
+	})
+	err = r.Close(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	assert.Same(t, publisher.Topic("topic"), publisher.Topic("topic"))
+	assert.Equal(t, 10, publisher.Topic("topic").PublishSettings.CountThreshold)
+
+	messages := srv.Messages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, []byte("hello"), messages[0].Data)
+	assert.Equal(t, map[string]string{
+		"x-request-id": "kept",
+		"traceparent":  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}, messages[0].Attributes)
+	assert.Equal(t, map[string]string{"x-request-id": "kept"}, attributesGiven)
+}
+
+func TestPublisherFeature_withInvalidSettings(t *testing.T) {
+	// given
+	t.Setenv("PUBSUB_EMULATOR_HOST", "localhost:0")
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set(features.PublisherBatchDelayEntry.Flag, "soon")
+
+	r, err := features.NewRegistry(new(features.PublisherFeature))
+	assert.Nil(t, err)
+
+	// when
+	err = r.Start(context.Background(), "service-name", nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "pubsub-batch-delay")
+}
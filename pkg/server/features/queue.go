@@ -0,0 +1,162 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReportQueueProvider is implemented by the feature providers reporting the
+// errors through a [ReportQueue], such as [FeatureProviderImpl].
+type ReportQueueProvider interface {
+	ReportQueue() *ReportQueue
+}
+
+// ReportQueue reports the errors asynchronously: the reports are buffered
+// in a bounded queue, and sent by a single worker. When the queue is full,
+// the reports are dropped rather than slowing down the caller.
+type ReportQueue struct {
+	reporter Reporter     // the reporter sending the reports
+	dropped  atomic.Int64 // the number of reports dropped
+
+	mu      sync.RWMutex  // guards closed and the reports sends
+	closed  bool          // whether the queue is closed
+	reports chan report   // the queued reports
+	done    chan struct{} // closed once the worker returns
+
+	stopCtx context.Context    // done once the worker must stop sending
+	stop    context.CancelFunc // stops the worker
+}
+
+// report is a queued report.
+type report struct {
+	ctx context.Context // the context of the report, see reportContext
+	err error           // the error to report
+	req *http.Request   // the request that failed, if any
+}
+
+// NewReportQueue creates a queue of the given size, and starts its worker
+// sending the reports using the reporter.
+func NewReportQueue(reporter Reporter, size int) *ReportQueue {
+	q := &ReportQueue{
+		reporter: reporter,
+		reports:  make(chan report, size),
+		done:     make(chan struct{}),
+	}
+	q.stopCtx, q.stop = context.WithCancel(context.Background())
+
+	go q.work()
+	return q
+}
+
+// Report queues the error. It never blocks: the report is dropped if the
+// queue is full or closed. The context values are kept, but not its
+// cancellation, as the report outlives the request: the context is only
+// canceled if [ReportQueue.Close] stops the worker. The stack trace of the
+// caller is attached to the error, see [WithStack].
+func (q *ReportQueue) Report(ctx context.Context, err error, req *http.Request) {
+	err = WithStack(err)
+	ctx = reportContext{Context: ctx, stopCtx: q.stopCtx}
+	if req != nil {
+		req = req.Clone(ctx)
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.dropped.Add(1)
+		return
+	}
+
+	select {
+	case q.reports <- report{ctx: ctx, err: err, req: req}:
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+// Depth returns the number of reports waiting in the queue.
+func (q *ReportQueue) Depth() int {
+	return len(q.reports)
+}
+
+// Dropped returns the number of reports dropped since the queue creation.
+func (q *ReportQueue) Dropped() int64 {
+	return q.dropped.Load()
+}
+
+// Close stops accepting reports, and waits for the queued reports to be
+// sent, at most until the context is done. The worker is then stopped: the
+// context of the reports is canceled, the remaining ones are dropped, and
+// Close returns once the worker did, so the reporter is not called after
+// Close returns. The reporter must return once its context is canceled.
+func (q *ReportQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.reports)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	depth := q.Depth()
+	q.stop()
+	<-q.done
+	return fmt.Errorf("%d reports not sent: %w", depth, ctx.Err())
+}
+
+// work sends the queued reports until the queue is closed, or drops them
+// once the worker is stopped.
+func (q *ReportQueue) work() {
+	defer close(q.done)
+
+	for r := range q.reports {
+		if q.stopCtx.Err() != nil {
+			q.dropped.Add(1)
+			continue
+		}
+
+		q.reporter.Report(r.ctx, r.err, r.req)
+	}
+}
+
+// reportContext carries the values of the context of a report, without its
+// cancellation, and is canceled once the worker is stopped.
+type reportContext struct {
+	context.Context                 // the context of the report, for its values
+	stopCtx         context.Context // done once the worker is stopped
+}
+
+// Deadline returns no deadline, the worker being stopped by Close.
+func (c reportContext) Deadline() (time.Time, bool) { return c.stopCtx.Deadline() }
+
+// Done is closed once the worker is stopped.
+func (c reportContext) Done() <-chan struct{} { return c.stopCtx.Done() }
+
+// Err returns the error of the stopped worker, if any.
+func (c reportContext) Err() error { return c.stopCtx.Err() }
+
+// registryReporter reports using the first started reporter of the
+// registry, if any. The reporter is looked up for every report, as it may
+// be started in the background.
+type registryReporter struct {
+	registry *Registry // the registry holding the reporter
+}
+
+// Report reports the error using the registry reporter.
+func (r registryReporter) Report(
+	ctx context.Context, err error, req *http.Request) {
+
+	if reporter, ok := Lookup[Reporter](r.registry); ok {
+		reporter.Report(ctx, err, req)
+	}
+}
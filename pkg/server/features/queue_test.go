@@ -0,0 +1,122 @@
+package features_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/stretchr/testify/assert"
+)
+
+// reporter recording the reports, blocked until released or canceled
+type reporterStub struct {
+	release chan struct{}
+
+	mu      sync.Mutex
+	reports []error
+	reqs    []*http.Request
+}
+
+func newReporterStub(blocked bool) *reporterStub {
+	r := &reporterStub{release: make(chan struct{})}
+	if !blocked {
+		close(r.release)
+	}
+	return r
+}
+
+func (r *reporterStub) Report(ctx context.Context, err error, req *http.Request) {
+	select {
+	case <-r.release:
+	case <-ctx.Done():
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reports = append(r.reports, err)
+	r.reqs = append(r.reqs, req)
+}
+
+func (r *reporterStub) Reports() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]error(nil), r.reports...)
+}
+
+func TestReportQueue(t *testing.T) {
+	// given
+	reporter := newReporterStub(false)
+	q := features.NewReportQueue(reporter, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(ctx)
+	errGiven := errors.New("failed")
+
+	// when
+	q.Report(ctx, errGiven, req)
+	cancel()
+	errClose := q.Close(context.Background())
+
+	// then
+	assert.Nil(t, errClose)
+	assert.Len(t, reporter.Reports(), 1)
+	assert.ErrorIs(t, reporter.Reports()[0], errGiven)
+	assert.Equal(t, "/orders", reporter.reqs[0].URL.Path)
+	assert.Nil(t, reporter.reqs[0].Context().Err())
+	assert.Zero(t, q.Dropped())
+}
+
+func TestReportQueue_full_shouldDrop(t *testing.T) {
+	// given
+	reporter := newReporterStub(true)
+	q := features.NewReportQueue(reporter, 2)
+
+	// the worker holds the first report
+	q.Report(context.Background(), errors.New("failed"), nil)
+	assert.Eventually(t, func() bool {
+		return q.Depth() == 0
+	}, time.Second, time.Millisecond)
+
+	// when
+	for i := 0; i < 4; i++ {
+		q.Report(context.Background(), errors.New("failed"), nil)
+	}
+	depth, dropped := q.Depth(), q.Dropped()
+	close(reporter.release)
+	errClose := q.Close(context.Background())
+
+	// then
+	assert.Equal(t, 2, depth)
+	assert.Equal(t, int64(2), dropped)
+	assert.Nil(t, errClose)
+	assert.Len(t, reporter.Reports(), 3)
+}
+
+func TestReportQueue_Close_shouldTimeout(t *testing.T) {
+	// given
+	reporter := newReporterStub(true)
+	q := features.NewReportQueue(reporter, 2)
+	q.Report(context.Background(), errors.New("first"), nil)
+	q.Report(context.Background(), errors.New("second"), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// when
+	errClose := q.Close(ctx)
+	q.Report(context.Background(), errors.New("after close"), nil)
+	close(reporter.release)
+
+	// then, the worker is stopped and the reporter no longer called
+	assert.ErrorIs(t, errClose, context.DeadlineExceeded)
+	assert.Equal(t, int64(2), q.Dropped())
+	assert.Empty(t, reporter.Reports())
+}
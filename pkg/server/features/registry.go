@@ -0,0 +1,364 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/buildinfo"
+)
+
+// Feature is a single cloud capability, such as a client to a cloud API.
+// Features are registered into a Registry, which starts them in dependency
+// order and closes them in reverse order.
+type Feature interface {
+	// Name uniquely identifies the feature in the registry.
+	Name() string
+	// DependsOn lists the names of the features that must be started first.
+	DependsOn() []string
+
+	// Start initializes the feature. Dependencies can be retrieved from the
+	// registry using [Lookup].
+	Start(ctx context.Context, r *Registry) error
+	// Close releases the feature resources.
+	Close(ctx context.Context) error
+}
+
+// Reporter is implemented by the features able to report errors.
+type Reporter interface {
+	Report(ctx context.Context, err error, req *http.Request)
+}
+
+// RegistryProvider is implemented by the feature providers backed by a
+// Registry, such as [FeatureProviderImpl].
+type RegistryProvider interface {
+	Registry() *Registry
+}
+
+// Registry holds independently enabled features.
+// The zero value is an empty registry ready to use.
+type Registry struct {
+	serviceName string            // the service using the features
+	version     string            // the version of the service
+	onError     func(err error)   // the callback for asynchronous errors
+	features    []Feature         // the registered features
+	disabled    map[string]bool   // the features names disabled
+	policies    map[string]Policy // the features policies, if not required
+	retryMin    time.Duration     // the initial pause between background starts
+	retryMax    time.Duration     // the maximum pause between background starts
+
+	mu      sync.RWMutex     // guards started and pending
+	started []Feature        // the started features, in start order
+	pending map[string]error // the features started in the background, by name
+
+	cancelPending context.CancelFunc // stops the background starts
+	pendingDone   chan struct{}      // closed once the background starts stop
+}
+
+// NewRegistry creates a registry with the given features.
+func NewRegistry(features ...Feature) (*Registry, error) {
+	r := new(Registry)
+	if err := r.Register(features...); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Register adds features to the registry.
+// It fails if a feature with the same name is already registered.
+func (r *Registry) Register(features ...Feature) error {
+	for _, feature := range features {
+		if r.get(feature.Name()) != nil {
+			return fmt.Errorf("feature %s already registered", feature.Name())
+		}
+
+		r.features = append(r.features, feature)
+	}
+
+	return nil
+}
+
+// Disable prevents the named feature from being started.
+// Starting the registry fails if an enabled feature depends on it.
+func (r *Registry) Disable(name string) {
+	if r.disabled == nil {
+		r.disabled = make(map[string]bool)
+	}
+
+	r.disabled[name] = true
+}
+
+// Enabled says if the named feature is registered and not disabled.
+func (r *Registry) Enabled(name string) bool {
+	return r.get(name) != nil && !r.disabled[name]
+}
+
+// ServiceName returns the name of the service the features are started for.
+func (r *Registry) ServiceName() string {
+	return r.serviceName
+}
+
+// SetServiceVersion sets the version of the service the features are
+// started for. It must be called before Start.
+func (r *Registry) SetServiceVersion(version string) {
+	r.version = version
+}
+
+// ServiceVersion returns the version of the service the features are started
+// for. Unless set, it is the version read from the build information.
+func (r *Registry) ServiceVersion() string {
+	if r.version == "" {
+		return buildinfo.Read().Version
+	}
+
+	return r.version
+}
+
+// OnError forwards an asynchronous feature error to the registry callback.
+func (r *Registry) OnError(err error) {
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
+
+// The feature states reported by [Registry.Status].
+const (
+	StateRegistered = "registered" // the feature is not started yet
+	StateStarted    = "started"    // the feature is started
+	StatePending    = "pending"    // the feature is started in the background
+	StateDisabled   = "disabled"   // the feature is disabled
+)
+
+// FeatureStatus describes a registered feature.
+type FeatureStatus struct {
+	Name      string   `json:"name"`            // the feature name
+	DependsOn []string `json:"dependsOn"`       // the feature dependencies
+	State     string   `json:"state"`           // the feature state
+	Policy    string   `json:"policy"`          // the feature policy
+	Error     string   `json:"error,omitempty"` // the last start error, if pending
+}
+
+// Status returns the status of the registered features, in registration
+// order.
+func (r *Registry) Status() []FeatureStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	started := make(map[string]bool, len(r.started))
+	for _, feature := range r.started {
+		started[feature.Name()] = true
+	}
+
+	status := make([]FeatureStatus, 0, len(r.features))
+	for _, feature := range r.features {
+		state, errMessage := StateRegistered, ""
+		pendingErr, pending := r.pending[feature.Name()]
+		switch {
+		case r.disabled[feature.Name()]:
+			state = StateDisabled
+		case started[feature.Name()]:
+			state = StateStarted
+		case pending:
+			state = StatePending
+			if pendingErr != nil {
+				errMessage = pendingErr.Error()
+			}
+		}
+
+		status = append(status, FeatureStatus{
+			Name:      feature.Name(),
+			DependsOn: feature.DependsOn(),
+			State:     state,
+			Policy:    r.policies[feature.Name()].String(),
+			Error:     errMessage,
+		})
+	}
+
+	return status
+}
+
+// Start starts the enabled features in dependency order. If a required
+// feature fails to start, the features already started are closed.
+//
+// The features that are not required, see [Registry.SetPolicy], are started
+// in the background when they fail or when they are lazy, along with the
+// features depending on them. The failures are given to the error callback
+// as a [DegradedError]. Until started, the features are not found by
+// [Lookup], their users falling back to a local behaviour.
+func (r *Registry) Start(
+	ctx context.Context, serviceName string, onError func(err error)) error {
+
+	r.serviceName = serviceName
+	r.onError = onError
+
+	ordered, err := r.sort()
+	if err != nil {
+		return fmt.Errorf("registry.sort: %v", err)
+	}
+
+	var pending []Feature
+	for _, feature := range ordered {
+		name := feature.Name()
+		policy := r.policies[name]
+
+		if !r.dependenciesStarted(feature) {
+			if policy == Required {
+				err := fmt.Errorf(
+					"feature %s depends on features not started", name)
+				return errors.Join(err, r.Close(ctx))
+			}
+
+			r.setPendingErr(name, nil)
+			pending = append(pending, feature)
+			continue
+		}
+
+		if policy == Lazy {
+			r.setPendingErr(name, nil)
+			pending = append(pending, feature)
+			continue
+		}
+
+		if err := feature.Start(ctx, r); err != nil {
+			err = fmt.Errorf("%s.Start: %w", name, err)
+			if policy == Required {
+				return errors.Join(err, r.Close(ctx))
+			}
+
+			r.setPendingErr(name, err)
+			r.OnError(&DegradedError{Feature: name, Err: err})
+			pending = append(pending, feature)
+			continue
+		}
+
+		r.addStarted(feature)
+	}
+
+	if len(pending) > 0 {
+		// the background starts outlive the start context, until Close
+		pendingCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		r.cancelPending = cancel
+		r.pendingDone = make(chan struct{})
+		go r.startPending(pendingCtx, pending)
+	}
+
+	return nil
+}
+
+// Close stops the background starts, then closes the started features in
+// reverse order. All features are closed, even if some fail, and the errors
+// are aggregated.
+func (r *Registry) Close(ctx context.Context) error {
+	var errs []error
+	if r.cancelPending != nil {
+		r.cancelPending()
+		select {
+		case <-r.pendingDone:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("background starts: %w", ctx.Err()))
+		}
+		r.cancelPending = nil
+	}
+
+	r.mu.Lock()
+	started := r.started
+	r.started = nil
+	r.pending = nil
+	r.mu.Unlock()
+
+	for i := len(started) - 1; i >= 0; i-- {
+		feature := started[i]
+		if err := feature.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s.Close: %w", feature.Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Lookup returns the first started feature of type T. T can either be a
+// concrete feature type or an interface such as [Reporter].
+func Lookup[T any](r *Registry) (T, bool) {
+	var zero T
+	if r == nil {
+		return zero, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, feature := range r.started {
+		if typed, ok := feature.(T); ok {
+			return typed, true
+		}
+	}
+
+	return zero, false
+}
+
+// get returns the named registered feature, or nil.
+func (r *Registry) get(name string) Feature {
+	for _, feature := range r.features {
+		if feature.Name() == name {
+			return feature
+		}
+	}
+
+	return nil
+}
+
+// sort returns the enabled features ordered so that every feature comes after
+// its dependencies. Features without dependencies between them keep the
+// registration order.
+func (r *Registry) sort() ([]Feature, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := make(map[string]int)
+	ordered := make([]Feature, 0, len(r.features))
+
+	var visit func(feature Feature) error
+	visit = func(feature Feature) error {
+		switch state[feature.Name()] {
+		case visiting:
+			return fmt.Errorf("dependency cycle on feature %s", feature.Name())
+		case visited:
+			return nil
+		}
+
+		state[feature.Name()] = visiting
+		for _, name := range feature.DependsOn() {
+			dependency := r.get(name)
+			if dependency == nil || r.disabled[name] {
+				return fmt.Errorf("feature %s depends on %s which is not enabled",
+					feature.Name(), name)
+			}
+
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		state[feature.Name()] = visited
+
+		ordered = append(ordered, feature)
+		return nil
+	}
+
+	for _, feature := range r.features {
+		if r.disabled[feature.Name()] {
+			continue
+		}
+
+		if err := visit(feature); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
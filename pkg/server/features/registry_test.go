@@ -0,0 +1,179 @@
+package features_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/stretchr/testify/assert"
+)
+
+// feature recording its start and close calls
+type featureStub struct {
+	name      string
+	dependsOn []string
+	startErr  error
+	events    *[]string
+}
+
+func (f *featureStub) Name() string        { return f.name }
+func (f *featureStub) DependsOn() []string { return f.dependsOn }
+
+func (f *featureStub) Start(_ context.Context, _ *features.Registry) error {
+	*f.events = append(*f.events, "start "+f.name)
+	return f.startErr
+}
+
+func (f *featureStub) Close(_ context.Context) error {
+	*f.events = append(*f.events, "close "+f.name)
+	return nil
+}
+
+func TestRegistry_StartAndClose(t *testing.T) {
+	// given
+	events := make([]string, 0)
+	r, err := features.NewRegistry(
+		&featureStub{name: "pubsub", dependsOn: []string{"metadata"}, events: &events},
+		&featureStub{name: "metadata", events: &events},
+	)
+	assert.Nil(t, err)
+
+	// when
+	errStart := r.Start(context.Background(), "service-name", nil)
+	errClose := r.Close(context.Background())
+
+	// then
+	assert.Nil(t, errStart)
+	assert.Nil(t, errClose)
+	assert.Equal(t, []string{
+		"start metadata",
+		"start pubsub",
+		"close pubsub",
+		"close metadata",
+	}, events)
+	assert.Equal(t, "service-name", r.ServiceName())
+}
+
+func TestRegistry_Register_duplicate(t *testing.T) {
+	// given
+	events := make([]string, 0)
+	r := new(features.Registry)
+
+	// when
+	errFirst := r.Register(&featureStub{name: "metadata", events: &events})
+	errSecond := r.Register(&featureStub{name: "metadata", events: &events})
+
+	// then
+	assert.Nil(t, errFirst)
+	assert.NotNil(t, errSecond)
+	assert.Contains(t, errSecond.Error(), "already registered")
+}
+
+func TestRegistry_Start_withDisabledDependency(t *testing.T) {
+	// given
+	events := make([]string, 0)
+	r, err := features.NewRegistry(
+		&featureStub{name: "metadata", events: &events},
+		&featureStub{name: "pubsub", dependsOn: []string{"metadata"}, events: &events},
+	)
+	assert.Nil(t, err)
+
+	// when
+	r.Disable("metadata")
+	err = r.Start(context.Background(), "service-name", nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not enabled")
+	assert.Empty(t, events)
+	assert.False(t, r.Enabled("metadata"))
+	assert.True(t, r.Enabled("pubsub"))
+}
+
+func TestRegistry_Start_withCycle(t *testing.T) {
+	// given
+	events := make([]string, 0)
+	r, err := features.NewRegistry(
+		&featureStub{name: "a", dependsOn: []string{"b"}, events: &events},
+		&featureStub{name: "b", dependsOn: []string{"a"}, events: &events},
+	)
+	assert.Nil(t, err)
+
+	// when
+	err = r.Start(context.Background(), "service-name", nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "dependency cycle")
+}
+
+func TestRegistry_Start_shouldFail(t *testing.T) {
+	// given
+	events := make([]string, 0)
+	errorGiven := fmt.Errorf("start failed")
+	r, err := features.NewRegistry(
+		&featureStub{name: "metadata", events: &events},
+		&featureStub{name: "pubsub", startErr: errorGiven, events: &events},
+	)
+	assert.Nil(t, err)
+
+	// when
+	err = r.Start(context.Background(), "service-name", nil)
+
+	// then
+	assert.ErrorIs(t, err, errorGiven)
+	assert.Equal(t, []string{
+		"start metadata",
+		"start pubsub",
+		"close metadata",
+	}, events)
+}
+
+func TestLookup(t *testing.T) {
+	// given
+	events := make([]string, 0)
+	featureGiven := &featureStub{name: "metadata", events: &events}
+	r, err := features.NewRegistry(featureGiven)
+	assert.Nil(t, err)
+
+	// when
+	_, okBefore := features.Lookup[*featureStub](r)
+	err = r.Start(context.Background(), "service-name", nil)
+	featureActual, okAfter := features.Lookup[*featureStub](r)
+	_, okReporter := features.Lookup[features.Reporter](r)
+
+	// then
+	assert.Nil(t, err)
+	assert.False(t, okBefore)
+	assert.True(t, okAfter)
+	assert.Same(t, featureGiven, featureActual)
+	assert.False(t, okReporter)
+}
+
+func TestRegistry_Status(t *testing.T) {
+	// given
+	events := make([]string, 0)
+	r, err := features.NewRegistry(
+		&featureStub{name: "metadata", events: &events},
+		&featureStub{name: "pubsub", dependsOn: []string{"metadata"}, events: &events},
+		&featureStub{name: "secrets", events: &events},
+	)
+	assert.Nil(t, err)
+	r.Disable("secrets")
+
+	// when
+	before := r.Status()
+	errStart := r.Start(context.Background(), "service-name", nil)
+	after := r.Status()
+
+	// then
+	assert.Nil(t, errStart)
+	assert.Equal(t, features.StateRegistered, before[0].State)
+	assert.Equal(t, []features.FeatureStatus{
+		{Name: "metadata", State: features.StateStarted, Policy: "required"},
+		{Name: "pubsub", DependsOn: []string{"metadata"},
+			State: features.StateStarted, Policy: "required"},
+		{Name: "secrets", State: features.StateDisabled, Policy: "required"},
+	}, after)
+}
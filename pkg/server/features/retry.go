@@ -0,0 +1,81 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+)
+
+// The retry policy used for transient cloud errors.
+const (
+	retryAttempts = 5                      // maximum number of attempts
+	retryBackoff  = 200 * time.Millisecond // initial pause between attempts
+)
+
+// retry calls fn until it succeeds, fails with an error that is not
+// transient, or the attempts are exhausted. The pause between two attempts is
+// doubled every time. It gives up early when the context is done.
+func retry(ctx context.Context, fn func() error) error {
+	backoff := retryBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !isTransient(err) {
+			return err
+		}
+
+		if attempt == retryAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+	}
+}
+
+// isTransient says if the error is worth retrying: metadata server errors,
+// unexpected EOF and network timeouts.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var metadataErr *metadata.Error
+	if errors.As(err, &metadataErr) {
+		return metadataErr.Code >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return false
+}
+
+// contextTransport is an http.RoundTripper that binds every request to a
+// context. It allows to cancel clients that do not take a context, such as
+// the metadata client.
+type contextTransport struct {
+	ctx  context.Context   // the context bound to the requests
+	base http.RoundTripper // the actual transport
+}
+
+// RoundTrip sends the request using the bound context.
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
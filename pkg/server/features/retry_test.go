@@ -0,0 +1,71 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry_withTransientError(t *testing.T) {
+	// given
+	calls := 0
+	fn := func() error {
+		calls++
+		if calls < 3 {
+			return &metadata.Error{Code: 503}
+		}
+		return nil
+	}
+
+	// when
+	err := retry(context.Background(), fn)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetry_withPermanentError(t *testing.T) {
+	// given
+	calls := 0
+	errorGiven := metadata.NotDefinedError("project/project-id")
+	fn := func() error {
+		calls++
+		return errorGiven
+	}
+
+	// when
+	err := retry(context.Background(), fn)
+
+	// then
+	assert.ErrorIs(t, err, errorGiven)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetry_withCanceledContext(t *testing.T) {
+	// given
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fn := func() error {
+		return io.ErrUnexpectedEOF
+	}
+
+	// when
+	err := retry(ctx, fn)
+
+	// then
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient(&metadata.Error{Code: 500}))
+	assert.True(t, isTransient(fmt.Errorf("read: %w", io.ErrUnexpectedEOF)))
+	assert.False(t, isTransient(&metadata.Error{Code: 403}))
+	assert.False(t, isTransient(context.DeadlineExceeded))
+	assert.False(t, isTransient(fmt.Errorf("other error")))
+}
@@ -0,0 +1,122 @@
+package features
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// maxStackDepth is the maximum number of frames of a captured stack.
+const maxStackDepth = 64
+
+// StackTracer is implemented by the errors carrying the stack trace of where
+// they occurred, in the [runtime.Stack] format expected by Error Reporting.
+type StackTracer interface {
+	StackTrace() []byte
+}
+
+// stackError attaches a stack trace to an error.
+type stackError struct {
+	err   error  // the actual error
+	stack []byte // the stack trace
+}
+
+// Error returns the actual error message.
+func (e *stackError) Error() string { return e.err.Error() }
+
+// Unwrap returns the actual error.
+func (e *stackError) Unwrap() error { return e.err }
+
+// StackTrace returns the stack trace.
+func (e *stackError) StackTrace() []byte { return e.stack }
+
+// WithStack returns the error along the stack trace of the caller, unless the
+// error already carries one. The frames of this package are skipped.
+func WithStack(err error) error {
+	return WithStackSkipping(err)
+}
+
+// WithStackSkipping is like [WithStack], but also skips the innermost frames
+// of the functions whose name starts with one of the prefixes, such as the
+// frames of a framework calling this package.
+func WithStackSkipping(err error, prefixes ...string) error {
+	if err == nil || stackOf(err) != nil {
+		return err
+	}
+
+	return &stackError{err: err, stack: callerStack(prefixes...)}
+}
+
+// stackOf returns the stack trace carried by the error, or nil.
+func stackOf(err error) []byte {
+	var tracer StackTracer
+	if errors.As(err, &tracer) {
+		return tracer.StackTrace()
+	}
+
+	return nil
+}
+
+// callerStack returns the stack of the current goroutine, in the
+// [runtime.Stack] format, without the innermost frames of this package and
+// of the functions starting with one of the prefixes.
+func callerStack(prefixes ...string) []byte {
+	pc := make([]uintptr, maxStackDepth)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(1, pc)])
+
+	var b bytes.Buffer
+	b.WriteString(goroutineHeader())
+
+	skipping := true
+	for {
+		frame, more := frames.Next()
+		if skipping && !isSkipped(frame.Function, prefixes) {
+			skipping = false
+		}
+
+		if !skipping {
+			fmt.Fprintf(&b, "%s(...)\n\t%s:%d +0x%x\n",
+				frame.Function, frame.File, frame.Line, frame.PC-frame.Entry)
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return b.Bytes()
+}
+
+// packagePrefix prefixes the function names of this package.
+var packagePrefix = reflect.TypeOf((*Registry)(nil)).Elem().PkgPath() + "."
+
+// isSkipped says if the function belongs to this package, or starts with
+// one of the prefixes.
+func isSkipped(function string, prefixes []string) bool {
+	if strings.HasPrefix(function, packagePrefix) {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// goroutineHeader returns the first line of the current goroutine stack,
+// such as "goroutine 7 [running]:".
+func goroutineHeader() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		return string(buf[:i+1])
+	}
+
+	return "goroutine 1 [running]:\n"
+}
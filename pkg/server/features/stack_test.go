@@ -0,0 +1,31 @@
+package features_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithStack(t *testing.T) {
+	// given
+	errGiven := errors.New("failed")
+
+	// when
+	errStack := features.WithStack(errGiven)
+	errTwice := features.WithStack(errStack)
+
+	var tracer features.StackTracer
+	ok := errors.As(errStack, &tracer)
+
+	// then
+	assert.ErrorIs(t, errStack, errGiven)
+	assert.Equal(t, "failed", errStack.Error())
+	assert.Same(t, errStack, errTwice)
+	assert.True(t, ok)
+	assert.Regexp(t,
+		`^goroutine \d+ \[running\]:\n.*features_test\.TestWithStack\(\.\.\.\)\n\t.*stack_test.go:\d+ \+0x[0-9a-f]+\n`,
+		string(tracer.StackTrace()))
+	assert.Nil(t, features.WithStack(nil))
+}
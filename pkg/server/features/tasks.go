@@ -0,0 +1,351 @@
+package features
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
+	"cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The headers set by Cloud Tasks on the task requests.
+const (
+	TaskQueueHeader            = "X-CloudTasks-QueueName"
+	TaskNameHeader             = "X-CloudTasks-TaskName"
+	TaskRetryCountHeader       = "X-CloudTasks-TaskRetryCount"
+	TaskExecutionCountHeader   = "X-CloudTasks-TaskExecutionCount"
+	TaskETAHeader              = "X-CloudTasks-TaskETA"
+	TaskPreviousResponseHeader = "X-CloudTasks-TaskPreviousResponse"
+)
+
+// ErrTaskExists is returned when enqueuing a task whose name was already used
+// in the queue.
+var ErrTaskExists = errors.New("task already exists")
+
+// Task is an HTTP task calling the service itself.
+type Task struct {
+	// Name deduplicates the tasks: a task with the same name cannot be
+	// enqueued again in the same queue. A name is generated if empty.
+	Name string
+	// Method is the HTTP method, it defaults to POST.
+	Method string
+	// Path is the path called on the service, such as "/tasks/cleanup".
+	Path string
+	// Header holds the HTTP headers of the task request.
+	Header http.Header
+	// Body is the body of the task request.
+	Body []byte
+	// ScheduleTime is the time the task is run. The task is run
+	// immediately if zero.
+	ScheduleTime time.Time
+}
+
+// TaskQueue creates tasks in a named queue. It returns the task name.
+type TaskQueue interface {
+	CreateTask(ctx context.Context, queue string, task *Task) (string, error)
+}
+
+// TasksFeature enqueues HTTP tasks calling the service itself, using Cloud
+// Tasks. The task requests are authenticated with an OIDC token of the
+// [TasksServiceAccountEntry] service account.
+//
+// It is not a default feature, it must be registered. Setting the Queue
+// field before the start, such as with a [LocalTaskQueue], replaces Cloud
+// Tasks.
+type TasksFeature struct {
+	Client *cloudtasks.Client // the Cloud Tasks client, if used
+	Queue  TaskQueue          // the queue backend
+}
+
+// Name returns [TasksName].
+func (f *TasksFeature) Name() string { return TasksName }
+
+// DependsOn returns [MetadataName] when using Cloud Tasks, to build the
+// queues full name.
+func (f *TasksFeature) DependsOn() []string {
+	if f.Queue != nil {
+		return nil
+	}
+
+	return []string{MetadataName}
+}
+
+// Start creates the Cloud Tasks client, unless a queue is already set.
+func (f *TasksFeature) Start(ctx context.Context, r *Registry) error {
+	if f.Queue != nil {
+		return nil
+	}
+
+	serviceURL := strings.TrimSuffix(TasksServiceURLEntry.Value(), "/")
+	if serviceURL == "" {
+		return fmt.Errorf("%s entry is required", TasksServiceURLEntry.Flag)
+	}
+
+	// the task handlers reject the requests without token
+	serviceAccount := TasksServiceAccountEntry.Value()
+	if serviceAccount == "" {
+		return fmt.Errorf("%s entry is required", TasksServiceAccountEntry.Flag)
+	}
+
+	metadataFeature, ok := Lookup[*MetadataFeature](r)
+	if !ok {
+		return fmt.Errorf("metadata feature not started")
+	}
+
+	client, err := cloudtasks.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("cloudtasks.NewClient: %v", err)
+	}
+
+	f.Client = client
+	f.Queue = &cloudTaskQueue{
+		client: client,
+		parent: fmt.Sprintf("projects/%s/locations/%s",
+			metadataFeature.ProjectID, TasksLocationEntry.Value()),
+		serviceURL:     serviceURL,
+		serviceAccount: serviceAccount,
+	}
+	return nil
+}
+
+// Enqueue creates the task in the named queue and returns the task name.
+// It returns [ErrTaskExists] if the task name was already used. The method
+// must be supported by Cloud Tasks, and the path must be absolute.
+func (f *TasksFeature) Enqueue(
+	ctx context.Context, queue string, task Task) (string, error) {
+
+	if task.Method == "" {
+		task.Method = http.MethodPost
+	}
+
+	return f.Queue.CreateTask(ctx, queue, &task)
+}
+
+// Close closes the Cloud Tasks client, if any.
+func (f *TasksFeature) Close(ctx context.Context) error {
+	if f.Client == nil {
+		return nil
+	}
+
+	return wait(ctx, f.Client.Close)
+}
+
+// cloudTaskQueue creates the tasks using Cloud Tasks.
+type cloudTaskQueue struct {
+	client         *cloudtasks.Client // the Cloud Tasks client
+	parent         string             // the location full name
+	serviceURL     string             // the base URL of the service
+	serviceAccount string             // the OIDC token service account
+}
+
+// CreateTask creates an HTTP task targeting the service.
+func (q *cloudTaskQueue) CreateTask(
+	ctx context.Context, queue string, task *Task) (string, error) {
+
+	method, err := validateTask(task)
+	if err != nil {
+		return "", fmt.Errorf("validateTask: %v", err)
+	}
+
+	queueName := q.parent + "/queues/" + queue
+
+	httpRequest := &cloudtaskspb.HttpRequest{
+		Url:        q.serviceURL + task.Path,
+		HttpMethod: method,
+		Headers:    make(map[string]string),
+		Body:       task.Body,
+		AuthorizationHeader: &cloudtaskspb.HttpRequest_OidcToken{
+			OidcToken: &cloudtaskspb.OidcToken{
+				ServiceAccountEmail: q.serviceAccount,
+			},
+		},
+	}
+	for key := range task.Header {
+		httpRequest.Headers[key] = task.Header.Get(key)
+	}
+
+	req := &cloudtaskspb.CreateTaskRequest{
+		Parent: queueName,
+		Task: &cloudtaskspb.Task{
+			MessageType: &cloudtaskspb.Task_HttpRequest{
+				HttpRequest: httpRequest,
+			},
+		},
+	}
+	if task.Name != "" {
+		req.Task.Name = queueName + "/tasks/" + task.Name
+	}
+	if !task.ScheduleTime.IsZero() {
+		req.Task.ScheduleTime = timestamppb.New(task.ScheduleTime)
+	}
+
+	created, err := q.client.CreateTask(ctx, req)
+	if status.Code(err) == codes.AlreadyExists {
+		return "", fmt.Errorf("client.CreateTask: %w", ErrTaskExists)
+	}
+	if err != nil {
+		return "", fmt.Errorf("client.CreateTask: %v", err)
+	}
+
+	return created.GetName(), nil
+}
+
+// validateTask returns the Cloud Tasks method of the task, and checks its
+// path is absolute.
+func validateTask(task *Task) (cloudtaskspb.HttpMethod, error) {
+	method := cloudtaskspb.HttpMethod(cloudtaskspb.HttpMethod_value[task.Method])
+	if method == cloudtaskspb.HttpMethod_HTTP_METHOD_UNSPECIFIED {
+		return method, fmt.Errorf("unsupported method %q", task.Method)
+	}
+
+	if !strings.HasPrefix(task.Path, "/") {
+		return method, fmt.Errorf("invalid path %q", task.Path)
+	}
+	if _, err := url.ParseRequestURI(task.Path); err != nil {
+		return method, fmt.Errorf("invalid path %q: %v", task.Path, err)
+	}
+
+	return method, nil
+}
+
+// LocalTaskQueue is an in-memory TaskQueue delivering the tasks to an HTTP
+// handler, such as the server itself. It sets the Cloud Tasks headers and
+// retries the failed tasks, so task handlers can be tested without Cloud
+// Tasks.
+type LocalTaskQueue struct {
+	Handler     http.Handler  // the handler the tasks are delivered to
+	MaxAttempts int           // the delivery attempts, 1 if 0
+	Backoff     time.Duration // the pause between two attempts
+
+	mu       sync.Mutex      // guards names and counter
+	names    map[string]bool // the task names used, by queue
+	counter  int             // the generated names counter
+	inflight sync.WaitGroup  // the tasks being delivered
+}
+
+// CreateTask schedules the delivery of the task. It fails, like Cloud
+// Tasks, if the method is not supported or the path is not absolute.
+func (q *LocalTaskQueue) CreateTask(
+	_ context.Context, queue string, task *Task) (string, error) {
+
+	if _, err := validateTask(task); err != nil {
+		return "", fmt.Errorf("validateTask: %v", err)
+	}
+
+	q.mu.Lock()
+	if q.names == nil {
+		q.names = make(map[string]bool)
+	}
+
+	name := task.Name
+	if name == "" {
+		q.counter++
+		name = "local-" + strconv.Itoa(q.counter)
+	}
+
+	if q.names[queue+"/"+name] {
+		q.mu.Unlock()
+		return "", ErrTaskExists
+	}
+	q.names[queue+"/"+name] = true
+	q.mu.Unlock()
+
+	task.Header = task.Header.Clone()
+	if task.ScheduleTime.IsZero() {
+		task.ScheduleTime = time.Now()
+	}
+
+	q.inflight.Add(1)
+	time.AfterFunc(time.Until(task.ScheduleTime), func() {
+		defer q.inflight.Done()
+		q.deliver(queue, name, task)
+	})
+
+	return name, nil
+}
+
+// Wait blocks until the scheduled tasks are delivered.
+func (q *LocalTaskQueue) Wait() {
+	q.inflight.Wait()
+}
+
+// deliver sends the task to the handler until it succeeds or the attempts
+// are exhausted.
+func (q *LocalTaskQueue) deliver(queue, name string, task *Task) {
+	maxAttempts := q.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	previous := 0
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(q.Backoff)
+		}
+
+		req, err := http.NewRequest(task.Method, task.Path, bytes.NewReader(task.Body))
+		if err != nil {
+			return
+		}
+		req.RequestURI = task.Path
+		for key, values := range task.Header {
+			req.Header[key] = values
+		}
+		req.Header.Set(TaskQueueHeader, queue)
+		req.Header.Set(TaskNameHeader, name)
+		req.Header.Set(TaskRetryCountHeader, strconv.Itoa(attempt))
+		req.Header.Set(TaskExecutionCountHeader, strconv.Itoa(attempt))
+		req.Header.Set(TaskETAHeader, strconv.FormatInt(task.ScheduleTime.Unix(), 10))
+		if previous != 0 {
+			req.Header.Set(TaskPreviousResponseHeader, strconv.Itoa(previous))
+		}
+
+		w := &taskResponseWriter{header: http.Header{}, status: http.StatusOK}
+		q.Handler.ServeHTTP(w, req)
+		if w.status >= 200 && w.status < 300 {
+			return
+		}
+
+		previous = w.status
+	}
+}
+
+// taskResponseWriter records the status of a task response and discards
+// its body, as Cloud Tasks does.
+type taskResponseWriter struct {
+	header      http.Header // the response header
+	status      int         // the response status
+	wroteHeader bool        // whether the header has been sent
+}
+
+// Header returns the response header.
+func (w *taskResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader records the status.
+func (w *taskResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.status = status
+	w.wroteHeader = true
+}
+
+// Write discards the body.
+func (w *taskResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return len(b), nil
+}
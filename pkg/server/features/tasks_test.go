@@ -0,0 +1,135 @@
+package features_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// taskRecorder records the requests of the delivered tasks.
+type taskRecorder struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	status   int
+}
+
+func (r *taskRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+	}
+}
+
+func TestTasksFeature_Enqueue(t *testing.T) {
+	// given
+	recorder := &taskRecorder{}
+	queue := &features.LocalTaskQueue{Handler: recorder}
+	f := &features.TasksFeature{Queue: queue}
+	assert.Nil(t, f.Start(context.Background(), &features.Registry{}))
+	scheduleGiven := time.Now().Add(10 * time.Millisecond)
+
+	// when
+	name, err := f.Enqueue(context.Background(), "queue", features.Task{
+		Name:         "task",
+		Path:         "/tasks/cleanup",
+		Header:       http.Header{"Content-Type": {"application/json"}},
+		Body:         []byte(`{}`),
+		ScheduleTime: scheduleGiven,
+	})
+	queue.Wait()
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "task", name)
+	assert.Len(t, recorder.requests, 1)
+
+	req := recorder.requests[0]
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "/tasks/cleanup", req.URL.Path)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "queue", req.Header.Get(features.TaskQueueHeader))
+	assert.Equal(t, "task", req.Header.Get(features.TaskNameHeader))
+	assert.Equal(t, "0", req.Header.Get(features.TaskRetryCountHeader))
+	assert.Nil(t, f.Close(context.Background()))
+}
+
+func TestTasksFeature_EnqueueWithDuplicateName(t *testing.T) {
+	// given
+	queue := &features.LocalTaskQueue{Handler: &taskRecorder{}}
+	f := &features.TasksFeature{Queue: queue}
+	taskGiven := features.Task{Name: "task", Path: "/tasks/cleanup"}
+
+	// when
+	_, errFirst := f.Enqueue(context.Background(), "queue", taskGiven)
+	_, errSecond := f.Enqueue(context.Background(), "queue", taskGiven)
+	_, errOther := f.Enqueue(context.Background(), "other-queue", taskGiven)
+	queue.Wait()
+
+	// then
+	assert.Nil(t, errFirst)
+	assert.ErrorIs(t, errSecond, features.ErrTaskExists)
+	assert.Nil(t, errOther)
+}
+
+func TestLocalTaskQueue_withFailingTask(t *testing.T) {
+	// given
+	recorder := &taskRecorder{status: http.StatusServiceUnavailable}
+	queue := &features.LocalTaskQueue{Handler: recorder, MaxAttempts: 3}
+	f := &features.TasksFeature{Queue: queue}
+
+	// when
+	_, err := f.Enqueue(context.Background(), "queue",
+		features.Task{Path: "/tasks/cleanup"})
+	queue.Wait()
+
+	// then
+	assert.Nil(t, err)
+	assert.Len(t, recorder.requests, 3)
+	last := recorder.requests[2]
+	assert.Equal(t, "2", last.Header.Get(features.TaskRetryCountHeader))
+	assert.Equal(t, "503", last.Header.Get(features.TaskPreviousResponseHeader))
+}
+
+func TestTasksFeature_EnqueueWithInvalidTask(t *testing.T) {
+	// given
+	queue := &features.LocalTaskQueue{Handler: &taskRecorder{}}
+	f := &features.TasksFeature{Queue: queue}
+	tasksGiven := []features.Task{
+		{Method: "BREW", Path: "/tasks/cleanup"},
+		{Path: "tasks/cleanup"},
+		{Path: "/tasks/%zz"},
+	}
+
+	for _, taskGiven := range tasksGiven {
+		// when
+		_, err := f.Enqueue(context.Background(), "queue", taskGiven)
+
+		// then
+		assert.NotNil(t, err, taskGiven)
+	}
+	queue.Wait()
+}
+
+func TestTasksFeature_StartWithoutServiceAccount_shouldFail(t *testing.T) {
+	// given
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set(features.TasksServiceURLEntry.Flag, "https://service.run.app")
+	f := &features.TasksFeature{}
+
+	// when
+	err := f.Start(context.Background(), &features.Registry{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), features.TasksServiceAccountEntry.Flag)
+}
@@ -0,0 +1,293 @@
+// Package flags evaluates feature flags, so behaviour changes can be rolled
+// out without a redeploy.
+//
+// A flag is either a boolean flag, on or off for every key, or a percentage
+// rollout, on for a stable share of the keys. The keys are hashed along the
+// flag name, so the same user keeps the same evaluation while the rollout
+// grows, and distinct flags are rolled out to distinct users.
+//
+// The flags are declared in code with their default values, possibly by
+// environment. The defaults are overridden from the "flags" section of the
+// config file, reloaded when the file changes:
+//
+//	flags:
+//	  new-checkout: true
+//	  search-v2: 25%
+package flags
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server/correlation"
+	"github.com/spf13/viper"
+)
+
+// ConfigSection is the config file section holding the flag overrides.
+const ConfigSection = "flags"
+
+// buckets is the number of buckets the keys are hashed into, giving the
+// rollouts a precision of a hundredth of percent.
+const buckets = 10000
+
+// Kind is the kind of a flag.
+type Kind int
+
+// The flag kinds.
+const (
+	Boolean    Kind = iota // the flag is on or off for every key
+	Percentage             // the flag is on for a share of the keys
+)
+
+// Flag declares a feature flag.
+//
+// The values of a boolean flag are "true" and "false". The values of a
+// percentage flag are percentages from 0 to 100, such as "25" or "25%", or
+// "true" and "false" for 100 and 0. An empty value is off.
+type Flag struct {
+	Name         string                        // the flag name, its key in the config section
+	Kind         Kind                          // the flag kind
+	Description  string                        // what the flag changes
+	DefaultValue string                        // the value unless set by environment or config
+	Environments map[config.Environment]string // the default values by environment
+}
+
+// Set holds the declared flags and evaluates them.
+type Set struct {
+	flags       map[string]Flag    // the declared flags, by lower-case name
+	defaults    map[string]float64 // the default rollouts of the environment
+	evaluations *expvar.Map        // the evaluation counts, by flag and result
+	watchOnce   sync.Once          // guards the config file watch
+
+	mu        sync.RWMutex       // guards overrides
+	overrides map[string]float64 // the rollouts set by the config file
+}
+
+// NewSet declares the flags for the environment and reads the overrides
+// from the config. It fails if a flag is declared twice, or if a default or
+// an override value is invalid.
+//
+// The flag names are case-insensitive, as the config keys.
+func NewSet(environment config.Environment, flags ...Flag) (*Set, error) {
+	s := &Set{
+		flags:       make(map[string]Flag, len(flags)),
+		defaults:    make(map[string]float64, len(flags)),
+		evaluations: new(expvar.Map).Init(),
+	}
+
+	for _, flag := range flags {
+		name := strings.ToLower(flag.Name)
+		if name == "" {
+			return nil, fmt.Errorf("flag without name")
+		}
+		if _, ok := s.flags[name]; ok {
+			return nil, fmt.Errorf("flag %s already declared", flag.Name)
+		}
+
+		value := flag.DefaultValue
+		if environmentValue, ok := flag.Environments[environment]; ok {
+			value = environmentValue
+		}
+
+		rollout, err := parse(flag.Kind, value)
+		if err != nil {
+			return nil, fmt.Errorf("flag %s default: %v", flag.Name, err)
+		}
+
+		s.flags[name] = flag
+		s.defaults[name] = rollout
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, fmt.Errorf("set.Reload: %v", err)
+	}
+
+	return s, nil
+}
+
+// Reload reads the overrides from the config section. If an override names
+// an undeclared flag or has an invalid value, the errors are returned and
+// the previous overrides are kept.
+func (s *Set) Reload() error {
+	overrides := make(map[string]float64)
+
+	var errs []error
+	for key, value := range viper.GetStringMap(ConfigSection) {
+		name := strings.ToLower(key)
+		flag, ok := s.flags[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("flag %s is not declared", key))
+			continue
+		}
+
+		rollout, err := parse(flag.Kind, fmt.Sprint(value))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("flag %s: %v", key, err))
+			continue
+		}
+
+		overrides[name] = rollout
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.overrides = overrides
+	return nil
+}
+
+// Watch reloads the overrides when the config file changes. The reload
+// errors are given to the callback. Watching more than once has no effect.
+//
+// It relies on [viper.OnConfigChange], replacing any callback set there.
+func (s *Set) Watch(onError func(err error)) {
+	s.watchOnce.Do(func() {
+		viper.OnConfigChange(func(fsnotify.Event) {
+			if err := s.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		})
+		viper.WatchConfig()
+	})
+}
+
+// Enabled evaluates the named flag for the key, such as a user identifier.
+// A percentage flag is on for the same keys as long as its rollout does not
+// shrink. Without key, a percentage flag is only on when fully rolled out.
+// An undeclared flag is off.
+func (s *Set) Enabled(name, key string) bool {
+	name = strings.ToLower(name)
+	rollout, ok := s.rollout(name)
+
+	var enabled bool
+	switch {
+	case !ok:
+		s.evaluations.Add(name+":undeclared", 1)
+		return false
+	case rollout >= 100:
+		enabled = true
+	case rollout <= 0 || key == "":
+		enabled = false
+	default:
+		enabled = bucket(name, key) < int(rollout*buckets/100)
+	}
+
+	if enabled {
+		s.evaluations.Add(name+":on", 1)
+	} else {
+		s.evaluations.Add(name+":off", 1)
+	}
+
+	return enabled
+}
+
+// EnabledContext evaluates the named flag for the key stored in the context
+// using [NewKeyContext], or else for the request identifier.
+func (s *Set) EnabledContext(ctx context.Context, name string) bool {
+	key, ok := KeyFromContext(ctx)
+	if !ok {
+		ids, _ := correlation.FromContext(ctx)
+		key = ids.RequestID
+	}
+
+	return s.Enabled(name, key)
+}
+
+// Rollouts returns the current rollout of every declared flag, in percent.
+func (s *Set) Rollouts() map[string]float64 {
+	rollouts := make(map[string]float64, len(s.flags))
+	for name := range s.flags {
+		rollouts[name], _ = s.rollout(name)
+	}
+
+	return rollouts
+}
+
+// Evaluations returns the evaluation counts, labeled by the flag name and
+// the result, such as "new-checkout:on".
+func (s *Set) Evaluations() map[string]int64 {
+	evaluations := make(map[string]int64)
+	s.evaluations.Do(func(kv expvar.KeyValue) {
+		evaluations[kv.Key] = kv.Value.(*expvar.Int).Value()
+	})
+
+	return evaluations
+}
+
+// rollout returns the rollout of the named flag, and whether it is declared.
+func (s *Set) rollout(name string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if rollout, ok := s.overrides[name]; ok {
+		return rollout, true
+	}
+
+	rollout, ok := s.defaults[name]
+	return rollout, ok
+}
+
+// parse returns the rollout of a flag value, in percent.
+func parse(kind Kind, value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	if kind == Boolean || strings.EqualFold(value, "true") ||
+		strings.EqualFold(value, "false") {
+
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid boolean value %q", value)
+		}
+
+		if enabled {
+			return 100, nil
+		}
+		return 0, nil
+	}
+
+	rollout, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || !(rollout >= 0 && rollout <= 100) {
+		return 0, fmt.Errorf("invalid percentage value %q", value)
+	}
+
+	return rollout, nil
+}
+
+// bucket hashes the key for the flag into a stable bucket.
+func bucket(name, key string) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum64() % buckets)
+}
+
+// contextKey is the type of the context key of the evaluation key.
+type contextKey struct{}
+
+// NewKeyContext returns a copy of the context holding the key the flags are
+// evaluated for, such as the authenticated user.
+func NewKeyContext(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// KeyFromContext returns the key the flags are evaluated for, if any.
+func KeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(contextKey{}).(string)
+	return key, ok
+}
@@ -0,0 +1,216 @@
+package flags_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server/correlation"
+	"github.com/planetfall/framework/pkg/server/flags"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSet(t *testing.T, overrides map[string]any, declared ...flags.Flag) (*flags.Set, error) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	if overrides != nil {
+		viper.Set(flags.ConfigSection, overrides)
+	}
+
+	return flags.NewSet(config.Production, declared...)
+}
+
+func TestSet_boolean(t *testing.T) {
+	// given
+	s, err := newSet(t, nil,
+		flags.Flag{Name: "on", DefaultValue: "true"},
+		flags.Flag{Name: "off"},
+		flags.Flag{
+			Name:         "prod-only",
+			DefaultValue: "false",
+			Environments: map[config.Environment]string{config.Production: "true"},
+		})
+	assert.Nil(t, err)
+
+	// when / then
+	assert.True(t, s.Enabled("on", "user-1"))
+	assert.True(t, s.Enabled("ON", ""))
+	assert.False(t, s.Enabled("off", "user-1"))
+	assert.True(t, s.Enabled("prod-only", "user-1"))
+	assert.False(t, s.Enabled("undeclared", "user-1"))
+	assert.Equal(t, map[string]int64{
+		"on:on":                 2,
+		"off:off":               1,
+		"prod-only:on":          1,
+		"undeclared:undeclared": 1,
+	}, s.Evaluations())
+}
+
+func TestSet_percentage(t *testing.T) {
+	// given
+	s, err := newSet(t, nil, flags.Flag{
+		Name:         "rollout",
+		Kind:         flags.Percentage,
+		DefaultValue: "25%",
+	})
+	assert.Nil(t, err)
+
+	// when
+	var enabled int
+	for i := 0; i < 10000; i++ {
+		if s.Enabled("rollout", fmt.Sprintf("user-%d", i)) {
+			enabled++
+		}
+	}
+
+	// then
+	assert.InDelta(t, 2500, enabled, 200)
+	assert.Equal(t, s.Enabled("rollout", "user-1"), s.Enabled("rollout", "user-1"))
+	assert.False(t, s.Enabled("rollout", ""))
+}
+
+func TestSet_percentageShouldKeepEnabledKeys(t *testing.T) {
+	// given
+	declared := flags.Flag{Name: "rollout", Kind: flags.Percentage, DefaultValue: "10"}
+	s, err := newSet(t, nil, declared)
+	assert.Nil(t, err)
+
+	var enabledBefore []string
+	for i := 0; i < 1000; i++ {
+		if key := fmt.Sprintf("user-%d", i); s.Enabled("rollout", key) {
+			enabledBefore = append(enabledBefore, key)
+		}
+	}
+
+	// when
+	viper.Set(flags.ConfigSection, map[string]any{"rollout": "50%"})
+	err = s.Reload()
+
+	// then
+	assert.Nil(t, err)
+	assert.NotEmpty(t, enabledBefore)
+	for _, key := range enabledBefore {
+		assert.True(t, s.Enabled("rollout", key), key)
+	}
+	assert.Equal(t, map[string]float64{"rollout": 50}, s.Rollouts())
+}
+
+func TestSet_overrides(t *testing.T) {
+	// given
+	s, err := newSet(t, map[string]any{"New-Checkout": true, "search": 100},
+		flags.Flag{Name: "new-checkout"},
+		flags.Flag{Name: "search", Kind: flags.Percentage})
+
+	// when / then
+	assert.Nil(t, err)
+	assert.True(t, s.Enabled("new-checkout", "user-1"))
+	assert.True(t, s.Enabled("search", "user-1"))
+}
+
+func TestSet_invalidReloadShouldKeepOverrides(t *testing.T) {
+	// given
+	s, err := newSet(t, map[string]any{"search": "30"},
+		flags.Flag{Name: "search", Kind: flags.Percentage})
+	assert.Nil(t, err)
+
+	testCases := map[string]map[string]any{
+		"undeclared flag": {"search": "50", "unknown": true},
+		"invalid value":   {"search": "150%"},
+		"not a number":    {"search": "half"},
+	}
+
+	for name, overridesGiven := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// when
+			viper.Set(flags.ConfigSection, overridesGiven)
+			err := s.Reload()
+
+			// then
+			assert.NotNil(t, err)
+			assert.Equal(t, map[string]float64{"search": 30}, s.Rollouts())
+		})
+	}
+}
+
+func TestNewSet_invalid_shouldFail(t *testing.T) {
+	testCases := map[string]struct {
+		overrides map[string]any
+		declared  []flags.Flag
+	}{
+		"without name": {declared: []flags.Flag{{}}},
+		"duplicate":    {declared: []flags.Flag{{Name: "a"}, {Name: "A"}}},
+		"boolean percentage": {declared: []flags.Flag{
+			{Name: "a", DefaultValue: "50"}}},
+		"invalid environment default": {declared: []flags.Flag{{
+			Name:         "a",
+			Environments: map[config.Environment]string{config.Production: "yes"},
+		}}},
+		"invalid override": {
+			overrides: map[string]any{"a": "maybe"},
+			declared:  []flags.Flag{{Name: "a"}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// when
+			s, err := newSet(t, tc.overrides, tc.declared...)
+
+			// then
+			assert.NotNil(t, err)
+			assert.Nil(t, s)
+		})
+	}
+}
+
+func TestSet_EnabledContext(t *testing.T) {
+	// given
+	s, err := newSet(t, nil,
+		flags.Flag{Name: "rollout", Kind: flags.Percentage, DefaultValue: "50"})
+	assert.Nil(t, err)
+
+	requestCtx := correlation.NewContext(context.Background(),
+		correlation.IDs{RequestID: "request-1"})
+
+	// when / then
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		keyCtx := flags.NewKeyContext(requestCtx, key)
+		assert.Equal(t, s.Enabled("rollout", key), s.EnabledContext(keyCtx, "rollout"))
+	}
+	assert.Equal(t,
+		s.Enabled("rollout", "request-1"), s.EnabledContext(requestCtx, "rollout"))
+	assert.False(t, s.EnabledContext(context.Background(), "rollout"))
+}
+
+func TestSet_Watch(t *testing.T) {
+	// given
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(configFile, []byte("flags:\n  checkout: false\n"), 0o600))
+	viper.SetConfigFile(configFile)
+	assert.Nil(t, viper.ReadInConfig())
+
+	s, err := flags.NewSet(config.Production, flags.Flag{Name: "checkout"})
+	assert.Nil(t, err)
+
+	errs := make(chan error, 1)
+	s.Watch(func(err error) { errs <- err })
+
+	// when
+	assert.False(t, s.Enabled("checkout", "user-1"))
+	assert.Nil(t, os.WriteFile(configFile, []byte("flags:\n  checkout: true\n"), 0o600))
+
+	// then
+	assert.Eventually(t, func() bool {
+		return s.Enabled("checkout", "user-1")
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Empty(t, errs)
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/correlation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// GRPC returns the gRPC server hosted by the server, creating it on the first
+// call. The services must be registered before serving.
+//
+// The calls go through interceptors equivalent to the HTTP middleware: the
+// request identifiers are set, the calls are logged and measured, and the
+// panics are recovered and raised. The standard health service is
+// registered, as well as the reflection service in Development.
+func (s *Server) GRPC() *grpc.Server {
+	s.grpcOnce.Do(func() {
+		opts := append([]grpc.ServerOption{
+			grpc.ChainUnaryInterceptor(
+				s.unaryRequestID, s.unaryObserve, s.unaryRecover),
+			grpc.ChainStreamInterceptor(
+				s.streamRequestID, s.streamObserve, s.streamRecover),
+		}, s.grpcOptions...)
+
+		s.grpcServer = grpc.NewServer(opts...)
+
+		s.health = health.NewServer()
+		healthpb.RegisterHealthServer(s.grpcServer, s.health)
+
+		if !s.cfg.Environment().OnCloud() {
+			reflection.Register(s.grpcServer)
+		}
+	})
+
+	return s.grpcServer
+}
+
+// Health returns the gRPC health service, to set the services status.
+func (s *Server) Health() *health.Server {
+	s.GRPC()
+	return s.health
+}
+
+// ServeGRPC listens on the address and serves the gRPC server until the
+// context is done. The server is then gracefully stopped within the shutdown
+// timeout. The start hooks are run before listening, see [Server.OnStart].
+func (s *Server) ServeGRPC(ctx context.Context, addr string) error {
+	if err := s.runStartHooks(ctx); err != nil {
+		return fmt.Errorf("runStartHooks: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("net.Listen: %v", err)
+	}
+
+	grpcServer := s.GRPC()
+	s.Logger.Printf("serving gRPC on %s", addr)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- grpcServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("grpcServer.Serve: %v", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	s.stopGRPC(shutdownCtx)
+	return <-served
+}
+
+// stopGRPC gracefully stops the gRPC server, if any. The pending calls are
+// aborted once the context is done.
+func (s *Server) stopGRPC(ctx context.Context) {
+	if s.grpcServer == nil {
+		return
+	}
+
+	s.Logger.Printf("stopping the gRPC server")
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+}
+
+// grpcCorrelationIDs stores the correlation identifiers into the context, using
+// the incoming metadata. The request identifier is sent back in the header.
+func grpcCorrelationIDs(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	header := make(http.Header)
+	for _, key := range []string{
+		RequestIDHeader, cloudTraceHeader, traceParentHeader,
+	} {
+		if values := md.Get(key); len(values) > 0 {
+			header.Set(key, values[0])
+		}
+	}
+
+	ids := newCorrelationIDs(header)
+
+	// the header can only fail to be sent once the call is over
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, ids.RequestID))
+	return correlation.NewContext(ctx, ids)
+}
+
+// observe logs and measures a completed gRPC call.
+func (s *Server) observe(
+	ctx context.Context, method string, start time.Time, err error) {
+
+	latency := time.Since(start)
+	code := status.Code(err)
+
+	s.metrics.Map("grpc_calls").Add(method+" "+code.String(), 1)
+	s.metrics.Map("grpc_latency_seconds").AddFloat(method, latency.Seconds())
+
+	serverError := grpcServerError(code)
+	if s.accessLog.exclude[method] || !s.accessLog.sampled(serverError) {
+		return
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case serverError:
+		level = slog.LevelError
+	case code != codes.OK:
+		level = slog.LevelWarn
+	}
+
+	s.StructuredLogger.LogAttrs(ctx, level,
+		fmt.Sprintf("%s %s", method, code),
+		slog.String("grpcMethod", method),
+		slog.String("grpcCode", code.String()),
+		slog.String("latency",
+			strconv.FormatFloat(latency.Seconds(), 'f', -1, 64)+"s"))
+}
+
+// grpcServerError says if the code means the server failed.
+func grpcServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable,
+		codes.DataLoss, codes.Unimplemented:
+		return true
+	}
+
+	return false
+}
+
+// recoverPanic raises a recovered panic with its stack and returns the error
+// sent to the client.
+func (s *Server) recoverPanic(
+	ctx context.Context, method string, recovered any) error {
+
+	err := newPanicError(recovered)
+	s.raise(ctx, "gRPC "+strings.TrimPrefix(method, "/"), err, nil)
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// unaryRequestID stores the correlation identifiers into the call context.
+func (s *Server) unaryRequestID(
+	ctx context.Context, req any,
+	_ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+	return handler(grpcCorrelationIDs(ctx), req)
+}
+
+// unaryObserve logs and measures the call.
+func (s *Server) unaryObserve(
+	ctx context.Context, req any,
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+	start := time.Now()
+	res, err := handler(ctx, req)
+	s.observe(ctx, info.FullMethod, start, err)
+
+	return res, err
+}
+
+// unaryRecover recovers the handler panics.
+func (s *Server) unaryRecover(
+	ctx context.Context, req any,
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = s.recoverPanic(ctx, info.FullMethod, recovered)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx context.Context // the stream context
+}
+
+// Context returns the overridden context.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// streamRequestID stores the correlation identifiers into the stream context.
+func (s *Server) streamRequestID(
+	srv any, ss grpc.ServerStream,
+	_ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	return handler(srv, &serverStream{
+		ServerStream: ss,
+		ctx:          grpcCorrelationIDs(ss.Context()),
+	})
+}
+
+// streamObserve logs and measures the stream.
+func (s *Server) streamObserve(
+	srv any, ss grpc.ServerStream,
+	info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	start := time.Now()
+	err := handler(srv, ss)
+	s.observe(ss.Context(), info.FullMethod, start, err)
+
+	return err
+}
+
+// streamRecover recovers the handler panics.
+func (s *Server) streamRecover(
+	srv any, ss grpc.ServerStream,
+	info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = s.recoverPanic(ss.Context(), info.FullMethod, recovered)
+		}
+	}()
+
+	return handler(srv, ss)
+}
@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// panicServiceDesc describes a service whose only method panics.
+var panicServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Panic",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Do",
+		Handler: func(
+			srv any, ctx context.Context,
+			dec func(any) error, interceptor grpc.UnaryServerInterceptor,
+		) (any, error) {
+			in := new(emptypb.Empty)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+
+			info := &grpc.UnaryServerInfo{FullMethod: "/test.Panic/Do"}
+			return interceptor(ctx, in, info, func(context.Context, any) (any, error) {
+				panic("handler panicked")
+			})
+		},
+	}},
+}
+
+// serveGRPC serves the server gRPC services on an in-memory listener and
+// returns a client connection.
+func serveGRPC(t *testing.T, s *server.Server) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = s.GRPC().Serve(listener)
+	}()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestGRPC_health(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	requestIDGiven := "request-id-given"
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(context.Background(), cfgGiven, serviceGiven)
+	assert.Nil(t, err)
+
+	conn := serveGRPC(t, s)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(
+		context.Background(), server.RequestIDHeader, requestIDGiven)
+	res, err := healthpb.NewHealthClient(conn).Check(
+		ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+	assert.Equal(t, []string{requestIDGiven},
+		header.Get(server.RequestIDHeader))
+	assert.NotNil(t, s.Metrics().Get("grpc_calls"))
+	assert.Contains(t, s.Metrics().String(), "/grpc.health.v1.Health/Check OK")
+
+	assert.Nil(t, s.Close())
+}
+
+func TestGRPC_withPanic(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+	var reported error
+	fpGiven.On("Report", mock.Anything).Run(func(args mock.Arguments) {
+		reported = args.Error(0)
+	}).Return()
+	fpGiven.On("Close").Return(nil)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
+	assert.Nil(t, err)
+
+	s.GRPC().RegisterService(&panicServiceDesc, struct{}{})
+	conn := serveGRPC(t, s)
+
+	err = conn.Invoke(context.Background(), "/test.Panic/Do",
+		&emptypb.Empty{}, &emptypb.Empty{})
+
+	var tracer features.StackTracer
+	ok := errors.As(reported, &tracer)
+
+	// then
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Nil(t, s.Close())
+	fpGiven.AssertExpectations(t)
+
+	// the stack starts at the panicking handler
+	assert.Equal(t, "gRPC test.Panic/Do: panic: handler panicked", reported.Error())
+	assert.True(t, ok)
+	assert.Regexp(t, `^goroutine \d+ \[running\]:\n\S+/server_test\.`,
+		string(tracer.StackTrace()))
+	assert.NotContains(t, string(tracer.StackTrace()), "runtime/debug.Stack")
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hook is a lifecycle hook, run when the server starts or stops.
+type Hook func(ctx context.Context) error
+
+// HookConfig configures a lifecycle hook.
+type HookConfig struct {
+	// Order sorts the hooks, the lower first. The start hooks with the same
+	// order run in the registration order, and the stop hooks in the reverse
+	// registration order.
+	Order int
+	// Timeout bounds the hook. The start hooks are not bounded when 0, and
+	// the stop hooks are bounded by the shutdown timeout.
+	Timeout time.Duration
+}
+
+// hook is a registered lifecycle hook.
+type hook struct {
+	name string     // the hook name
+	fn   Hook       // the hook function
+	cfg  HookConfig // the hook configuration
+}
+
+// hooks holds the lifecycle hooks of a server.
+type hooks struct {
+	mu    sync.Mutex // guards start and stop
+	start []hook     // the start hooks, in registration order
+	stop  []hook     // the stop hooks, in reverse registration order
+
+	startOnce sync.Once // guards the start hooks run
+	startErr  error     // the start hooks error
+}
+
+// OnStart registers a hook run before serving, such as to warm a cache once
+// the configuration is loaded. The start hooks are run once, by the first
+// call to [Server.ListenAndServe] or [Server.ServeGRPC], or by [RunJob],
+// which fail if a hook fails. The hooks following a failing one are not run.
+func (s *Server) OnStart(name string, fn Hook, cfg HookConfig) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+
+	s.hooks.start = append(s.hooks.start, hook{name: name, fn: fn, cfg: cfg})
+}
+
+// OnStop registers a hook run by [Server.Close], such as to close a database
+// pool. The stop hooks are run after the workers and the gRPC server are
+// stopped, and before the features are closed. Every stop hook is run, and
+// their errors are returned by Close.
+func (s *Server) OnStop(name string, fn Hook, cfg HookConfig) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+
+	s.hooks.stop = append([]hook{{name: name, fn: fn, cfg: cfg}}, s.hooks.stop...)
+}
+
+// runStartHooks runs the start hooks, unless they were already run. It
+// returns the error of the first failing hook. The hooks are run without
+// holding the lock, so they can register other hooks; the start hooks
+// registered meanwhile are not run.
+func (s *Server) runStartHooks(ctx context.Context) error {
+	s.hooks.startOnce.Do(func() {
+		s.hooks.mu.Lock()
+		start := sortHooks(s.hooks.start)
+		s.hooks.mu.Unlock()
+
+		for _, h := range start {
+			if err := s.runHook(ctx, "start", h); err != nil {
+				s.hooks.startErr = err
+				return
+			}
+		}
+	})
+
+	return s.hooks.startErr
+}
+
+// runStopHooks runs every stop hook and returns their errors.
+func (s *Server) runStopHooks(ctx context.Context) error {
+	s.hooks.mu.Lock()
+	stop := sortHooks(s.hooks.stop)
+	s.hooks.mu.Unlock()
+
+	var errs []error
+	for _, h := range stop {
+		if err := s.runHook(ctx, "stop", h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// runHook runs the hook within its timeout and logs its duration.
+func (s *Server) runHook(ctx context.Context, phase string, h hook) error {
+	if h.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.cfg.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := h.fn(ctx)
+	duration := time.Since(start)
+
+	if err != nil {
+		s.Logger.Printf("%s hook %s failed in %s: %v", phase, h.name, duration, err)
+		return fmt.Errorf("%s hook %s: %v", phase, h.name, err)
+	}
+
+	s.Logger.Printf("%s hook %s done in %s", phase, h.name, duration)
+	return nil
+}
+
+// sortHooks returns a copy of the hooks sorted by order, keeping the given
+// order of the hooks with the same order.
+func sortHooks(hooks []hook) []hook {
+	sorted := append([]hook(nil), hooks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].cfg.Order < sorted[j].cfg.Order
+	})
+
+	return sorted
+}
@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordHook returns a hook appending its name to the calls.
+func recordHook(calls *[]string, name string, err error) server.Hook {
+	return func(ctx context.Context) error {
+		*calls = append(*calls, name)
+		return err
+	}
+}
+
+func TestOnStart(t *testing.T) {
+	// given
+	output := &bytes.Buffer{}
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(output))
+	assert.Nil(t, err)
+	var calls []string
+	s.OnStart("cache", recordHook(&calls, "cache", nil), server.HookConfig{})
+	s.OnStart("migrations", recordHook(&calls, "migrations", nil),
+		server.HookConfig{Order: -1})
+	s.OnStart("pool", recordHook(&calls, "pool", nil), server.HookConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	err = s.ListenAndServe(ctx, "127.0.0.1:0")
+	errAgain := s.ListenAndServe(ctx, "127.0.0.1:0")
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, errAgain)
+	assert.Equal(t, []string{"migrations", "cache", "pool"}, calls)
+	assert.Contains(t, output.String(), "start hook cache done in")
+}
+
+func TestOnStart_registeringHooks(t *testing.T) {
+	// given
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(&bytes.Buffer{}))
+	assert.Nil(t, err)
+	var calls []string
+	s.OnStart("pool", func(ctx context.Context) error {
+		s.OnStop("pool", recordHook(&calls, "pool closed", nil),
+			server.HookConfig{})
+		return nil
+	}, server.HookConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	errStart := s.ListenAndServe(ctx, "127.0.0.1:0")
+	errClose := s.Close()
+
+	// then
+	assert.Nil(t, errStart)
+	assert.Nil(t, errClose)
+	assert.Equal(t, []string{"pool closed"}, calls)
+}
+
+func TestOnStart_shouldFail(t *testing.T) {
+	// given
+	output := &bytes.Buffer{}
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(output))
+	assert.Nil(t, err)
+	var calls []string
+	s.OnStart("migrations", recordHook(&calls, "migrations",
+		fmt.Errorf("schema conflict")), server.HookConfig{})
+	s.OnStart("cache", recordHook(&calls, "cache", nil), server.HookConfig{})
+
+	// when
+	err = s.ListenAndServe(context.Background(), "127.0.0.1:0")
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "start hook migrations: schema conflict")
+	assert.Equal(t, []string{"migrations"}, calls)
+}
+
+func TestOnStop(t *testing.T) {
+	// given
+	output := &bytes.Buffer{}
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(output))
+	assert.Nil(t, err)
+	var calls []string
+	s.OnStop("pool", recordHook(&calls, "pool", nil), server.HookConfig{})
+	s.OnStop("cache", recordHook(&calls, "cache",
+		fmt.Errorf("flush failed")), server.HookConfig{})
+	s.OnStop("tracer", recordHook(&calls, "tracer",
+		fmt.Errorf("export failed")), server.HookConfig{Order: 1})
+
+	// when
+	err = s.Close()
+
+	// then
+	assert.Equal(t, []string{"cache", "pool", "tracer"}, calls)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "stop hook cache: flush failed")
+	assert.Contains(t, err.Error(), "stop hook tracer: export failed")
+	assert.Contains(t, output.String(), "stop hook pool done in")
+}
+
+func TestOnStop_withTimeout(t *testing.T) {
+	// given
+	output := &bytes.Buffer{}
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(output))
+	assert.Nil(t, err)
+	s.OnStop("pool", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, server.HookConfig{Timeout: 10 * time.Millisecond})
+
+	// when
+	err = s.Close()
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "stop hook pool: context deadline exceeded")
+}
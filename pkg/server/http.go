@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Middleware wraps an HTTP handler to add a behavior before or after it.
+type Middleware func(next http.Handler) http.Handler
+
+// chain wraps the handler with the middleware, the first middleware being the
+// outermost one.
+func chain(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler
+}
+
+// Handle registers the handler for the given pattern. The requests go
+// through the server middleware before reaching the handler.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+	s.addRoute(pattern)
+}
+
+// HandleFunc registers the handler function for the given pattern.
+func (s *Server) HandleFunc(
+	pattern string, handler func(http.ResponseWriter, *http.Request)) {
+
+	s.mux.HandleFunc(pattern, handler)
+	s.addRoute(pattern)
+}
+
+// addRoute records the pattern of a registered handler.
+func (s *Server) addRoute(pattern string) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	s.routes = append(s.routes, pattern)
+}
+
+// ServeHTTP dispatches the request to the registered handlers, through the
+// server middleware.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(w, req)
+}
+
+// ListenAndServe listens on the address and serves the registered handlers
+// until the context is done. The server is then gracefully shut down within
+// the shutdown timeout. If the address is empty, the port set by the
+// [PortEntry] config entry is used. The start hooks are run before
+// listening, see [Server.OnStart]. The admin endpoints are served along,
+// when the [AdminAddrEntry] config entry is set, see [Server.ServeAdmin].
+//
+// When the server is created using [WithMultiplexing], the gRPC server is
+// served on the same address: HTTP/1.1 and HTTP/2 cleartext requests are
+// dispatched to the registered handlers, while the HTTP/2 requests with a
+// gRPC content-type are dispatched to the gRPC server.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if addr == "" {
+		addr = ":" + PortEntry.Value()
+	}
+
+	if err := s.runStartHooks(ctx); err != nil {
+		return fmt.Errorf("runStartHooks: %v", err)
+	}
+
+	httpServer := &http.Server{
+		Addr:    addr,
+		Handler: s,
+	}
+
+	if s.multiplexed {
+		httpServer.Handler = h2c.NewHandler(
+			s.multiplexer(s.GRPC()), &http2.Server{})
+	}
+
+	if adminAddr := AdminAddrEntry.Value(); adminAddr != "" {
+		go func() {
+			if err := s.ServeAdmin(ctx, adminAddr); err != nil {
+				s.Logger.Printf("could not serve the admin endpoints: %v", err)
+			}
+		}()
+	}
+
+	s.Logger.Printf("listening on %s", addr)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("httpServer.ListenAndServe: %v", err)
+	case <-ctx.Done():
+	}
+
+	s.Logger.Printf("shutting down the listener")
+
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	// the HTTP/2 connections are hijacked by the h2c handler, the gRPC
+	// server stops its own calls
+	if s.multiplexed {
+		s.stopGRPC(shutdownCtx)
+	}
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("httpServer.Shutdown: %v", err)
+	}
+
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("httpServer.ListenAndServe: %v", err)
+	}
+
+	return nil
+}
+
+// multiplexer dispatches the gRPC requests to the gRPC server, and the other
+// requests to the registered handlers.
+func (s *Server) multiplexer(grpcHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if isGRPCRequest(req) {
+			grpcHandler.ServeHTTP(w, req)
+			return
+		}
+
+		s.ServeHTTP(w, req)
+	})
+}
+
+// isGRPCRequest says if the request is a gRPC call: gRPC requires HTTP/2
+// and uses the application/grpc content-type and its variants.
+func isGRPCRequest(req *http.Request) bool {
+	return req.ProtoMajor == 2 &&
+		strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+// responseWriter records the status and the size of a response.
+type responseWriter struct {
+	http.ResponseWriter
+
+	status      int   // the response status
+	size        int64 // the number of body bytes written
+	wroteHeader bool  // whether the header has been sent
+}
+
+// newResponseWriter wraps the writer, unless it is already a responseWriter.
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader records the status and sends the header.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.status = status
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the body size and writes the body.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush sends the buffered body, such as for server-sent events. It
+// implements [http.Flusher] if the wrapped writer does.
+func (w *responseWriter) Flush() {
+	w.wroteHeader = true
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack takes over the connection, such as for websockets. It implements
+// [http.Hijacker] if the wrapped writer does.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.wroteHeader = true
+		w.status = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer, for [http.ResponseController].
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
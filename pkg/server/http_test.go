@@ -0,0 +1,177 @@
+package server_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// headerMiddleware appends the value to the X-Trail response header.
+func headerMiddleware(value string) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trail", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestServeHTTP_withMiddleware(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithMiddleware(
+			headerMiddleware("first"), headerMiddleware("second")))
+	assert.Nil(t, err)
+
+	s.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+
+	// then
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.Equal(t, []string{"first", "second"}, rec.Header().Values("X-Trail"))
+	cfgGiven.AssertExpectations(t)
+}
+
+func TestServeHTTP_withFlusherAndHijacker(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, "service-name")
+	assert.Nil(t, err)
+
+	var flusher, hijacker bool
+	var errHijack error
+	s.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		var f http.Flusher
+		f, flusher = w.(http.Flusher)
+		var h http.Hijacker
+		h, hijacker = w.(http.Hijacker)
+
+		_, _ = w.Write([]byte("data: ready\n\n"))
+		f.Flush()
+		_, _, errHijack = h.Hijack()
+	})
+
+	// when
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	// then, the recorder can flush but not be hijacked
+	assert.True(t, flusher)
+	assert.True(t, hijacker)
+	assert.True(t, rec.Flushed)
+	assert.ErrorIs(t, errHijack, http.ErrNotSupported)
+}
+
+func TestListenAndServe(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addrGiven := listener.Addr().String()
+	listener.Close()
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(context.Background(), cfgGiven, serviceGiven)
+	assert.Nil(t, err)
+
+	s.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ListenAndServe(ctx, addrGiven)
+	}()
+
+	var res *http.Response
+	assert.Eventually(t, func() bool {
+		res, err = http.Get("http://" + addrGiven + "/hello")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+
+	// then
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Nil(t, res.Body.Close())
+	assert.Nil(t, <-served)
+}
+
+func TestListenAndServe_withMultiplexing(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	_, portGiven, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set(server.PortEntry.Flag, portGiven)
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithMultiplexing())
+	assert.Nil(t, err)
+
+	s.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ListenAndServe(ctx, "")
+	}()
+
+	addr := "127.0.0.1:" + portGiven
+	var res *http.Response
+	assert.Eventually(t, func() bool {
+		res, err = http.Get("http://" + addr + "/hello")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	conn, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	healthRes, err := healthpb.NewHealthClient(conn).Check(
+		context.Background(), &healthpb.HealthCheckRequest{})
+	conn.Close()
+
+	cancel()
+
+	// then
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Nil(t, res.Body.Close())
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, healthRes.Status)
+	assert.Nil(t, <-served)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/planetfall/framework/pkg/config"
+)
+
+// The environment variables set by Cloud Run Jobs.
+const (
+	jobTaskIndexEnv   = "CLOUD_RUN_TASK_INDEX"
+	jobTaskCountEnv   = "CLOUD_RUN_TASK_COUNT"
+	jobTaskAttemptEnv = "CLOUD_RUN_TASK_ATTEMPT"
+)
+
+// JobFunc is the work of a job. The server gives access to the logger and
+// the features.
+type JobFunc func(ctx context.Context, s *Server) error
+
+// JobTask identifies the task of a Cloud Run Job execution. A job run outside
+// of Cloud Run Jobs is a single task.
+type JobTask struct {
+	Index   int // the task index, from 0
+	Count   int // the number of tasks of the execution
+	Attempt int // the times the task was retried
+}
+
+// jobTaskKey is the context key of the job task.
+type jobTaskKey struct{}
+
+// JobTaskFromContext returns the task of the job being run.
+func JobTaskFromContext(ctx context.Context) (JobTask, bool) {
+	task, ok := ctx.Value(jobTaskKey{}).(JobTask)
+	return task, ok
+}
+
+// RunJob runs a one-shot job, such as a Cloud Run Job task or a migration
+// tool, and exits the process. The configuration is read using
+// [config.NewConfig] with the entries and the server entries, and a server
+// is created without listening.
+//
+// The job context is done on SIGINT or SIGTERM. The start hooks are run
+// before the job, and the server is closed after it, flushing the reported
+// errors. The job failure is raised, and the process exits with the code 1.
+func RunJob(
+	ctx context.Context,
+	serviceName string,
+	entries []config.Entry,
+	fn JobFunc,
+	opts ...Option,
+) {
+	cfg, err := config.NewConfig(append(entries, Entries()...))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config.NewConfig: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	code := runJob(ctx, cfg, serviceName, fn, opts...)
+	stop()
+
+	os.Exit(code)
+}
+
+// runJob runs the job with a new server and returns the process exit code.
+func runJob(
+	ctx context.Context,
+	cfg config.Config,
+	serviceName string,
+	fn JobFunc,
+	opts ...Option,
+) int {
+	s, err := NewServer(ctx, cfg, serviceName, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "NewServer: %v\n", err)
+		return 1
+	}
+
+	code := 0
+	if err := s.executeJob(ctx, fn); err != nil {
+		s.raise(ctx, "job failed", err, nil)
+		code = 1
+	}
+
+	if err := s.Close(); err != nil {
+		s.Logger.Printf("could not close the server: %v", err)
+		code = 1
+	}
+
+	return code
+}
+
+// executeJob runs the start hooks and the job for the task set by the
+// environment. A panic is turned into an error.
+func (s *Server) executeJob(ctx context.Context, fn JobFunc) (err error) {
+	task, err := newJobTask()
+	if err != nil {
+		return fmt.Errorf("newJobTask: %v", err)
+	}
+
+	if err := s.runStartHooks(ctx); err != nil {
+		return fmt.Errorf("runStartHooks: %v", err)
+	}
+
+	s.Logger.Printf("running task %d of %d, attempt %d",
+		task.Index+1, task.Count, task.Attempt)
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = newPanicError(recovered)
+		}
+	}()
+
+	return fn(context.WithValue(ctx, jobTaskKey{}, task), s)
+}
+
+// newJobTask reads the task from the Cloud Run Jobs environment variables.
+func newJobTask() (JobTask, error) {
+	task := JobTask{Count: 1}
+
+	for env, dest := range map[string]*int{
+		jobTaskIndexEnv:   &task.Index,
+		jobTaskCountEnv:   &task.Count,
+		jobTaskAttemptEnv: &task.Attempt,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return task, fmt.Errorf("%s: %v", env, err)
+		}
+		*dest = n
+	}
+
+	if task.Index < 0 || task.Count < 1 || task.Index >= task.Count {
+		return task, fmt.Errorf("invalid task %d of %d", task.Index, task.Count)
+	}
+
+	return task, nil
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// configStub is a configuration with a fixed environment.
+type configStub struct {
+	environment config.Environment
+}
+
+func (c configStub) Environment() config.Environment {
+	return c.environment
+}
+
+func TestRunJob(t *testing.T) {
+	// given
+	t.Setenv(jobTaskIndexEnv, "2")
+	t.Setenv(jobTaskCountEnv, "4")
+	output := &bytes.Buffer{}
+	var taskActual JobTask
+	var stopped bool
+
+	// when
+	code := runJob(context.Background(), configStub{config.Development},
+		"service-name", func(ctx context.Context, s *Server) error {
+			taskActual, _ = JobTaskFromContext(ctx)
+			s.OnStop("pool", func(ctx context.Context) error {
+				stopped = true
+				return nil
+			}, HookConfig{})
+			return nil
+		}, WithOutput(output))
+
+	// then
+	assert.Equal(t, 0, code)
+	assert.Equal(t, JobTask{Index: 2, Count: 4}, taskActual)
+	assert.True(t, stopped)
+	assert.Contains(t, output.String(), "running task 3 of 4, attempt 0")
+}
+
+func TestRunJob_shouldFail(t *testing.T) {
+	// given
+	output := &bytes.Buffer{}
+
+	// when
+	code := runJob(context.Background(), configStub{config.Development},
+		"service-name", func(ctx context.Context, s *Server) error {
+			return fmt.Errorf("migration failed")
+		}, WithOutput(output))
+	codePanic := runJob(context.Background(), configStub{config.Development},
+		"service-name", func(ctx context.Context, s *Server) error {
+			panic("unexpected state")
+		}, WithOutput(output))
+
+	// then
+	assert.Equal(t, 1, code)
+	assert.Equal(t, 1, codePanic)
+	assert.Contains(t, output.String(), "job failed: migration failed")
+	assert.Contains(t, output.String(), "job failed: panic: unexpected state")
+}
+
+func TestRunJob_withInvalidTask(t *testing.T) {
+	// given
+	t.Setenv(jobTaskIndexEnv, "4")
+	t.Setenv(jobTaskCountEnv, "4")
+	var ran bool
+
+	// when
+	code := runJob(context.Background(), configStub{config.Development},
+		"service-name", func(ctx context.Context, s *Server) error {
+			ran = true
+			return nil
+		}, WithOutput(&bytes.Buffer{}))
+
+	// then
+	assert.Equal(t, 1, code)
+	assert.False(t, ran)
+}
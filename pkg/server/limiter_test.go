@@ -0,0 +1,30 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_withTooManyKeys(t *testing.T) {
+	// given
+	limiter := newRateLimiter("*", RateLimitConfig{Rate: 1, Burst: 2})
+	limiter.maxBuckets = 3
+	now := time.Now()
+
+	// when
+	for i := 0; i < 10; i++ {
+		limiter.allow(strconv.Itoa(i), now)
+	}
+	buckets := len(limiter.buckets)
+
+	refilled := now.Add(2 * time.Second)
+	limiter.allow("refilled", refilled)
+	limiter.allow("refilled", refilled)
+
+	// then
+	assert.Equal(t, 3, buckets)
+	assert.Len(t, limiter.buckets, 1)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RequestLimitConfig configures the limits of a route.
+type RequestLimitConfig struct {
+	// Timeout is the deadline of the request context. The handler is
+	// expected to return once the context is done. The requests are not
+	// bounded when 0.
+	Timeout time.Duration
+	// MaxBodyBytes is the maximum size of the request body. The body is not
+	// bounded when 0.
+	MaxBodyBytes int64
+}
+
+// RequestLimit returns a middleware bounding the duration and the body size
+// of the requests, such as:
+//
+//	s.Handle("/upload", s.RequestLimit("upload", cfg)(handler))
+//
+// A request whose body is larger than the limit gets a 413 problem. A
+// request whose deadline is exceeded gets a 503 problem, unless the handler
+// already answered. The timeouts are expected and are not raised, they are
+// counted in the "request_timeouts" metric, and the rejected bodies in the
+// "request_too_large" metric, both labeled with the name.
+func (s *Server) RequestLimit(name string, cfg RequestLimitConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rw := newResponseWriter(w)
+
+			var body *limitedBody
+			if cfg.MaxBodyBytes > 0 {
+				if req.ContentLength > cfg.MaxBodyBytes {
+					s.metrics.Map("request_too_large").Add(name, 1)
+					writeProblem(rw, req, http.StatusRequestEntityTooLarge,
+						fmt.Sprintf("the request body exceeds %d bytes", cfg.MaxBodyBytes))
+					return
+				}
+
+				body = &limitedBody{
+					ReadCloser: http.MaxBytesReader(rw, req.Body, cfg.MaxBodyBytes),
+				}
+				req.Body = body
+			}
+
+			if cfg.Timeout > 0 {
+				ctx, cancel := context.WithTimeout(req.Context(), cfg.Timeout)
+				defer cancel()
+				req = req.WithContext(ctx)
+			}
+
+			next.ServeHTTP(rw, req)
+
+			if body != nil && body.exceeded {
+				s.metrics.Map("request_too_large").Add(name, 1)
+			}
+
+			if errors.Is(req.Context().Err(), context.DeadlineExceeded) {
+				s.metrics.Map("request_timeouts").Add(name, 1)
+
+				if !rw.wroteHeader {
+					writeProblem(rw, req, http.StatusServiceUnavailable,
+						"the request timed out")
+				}
+			}
+		})
+	}
+}
+
+// limitedBody records whether the body limit was exceeded.
+type limitedBody struct {
+	io.ReadCloser
+
+	exceeded bool // whether the limit was exceeded
+}
+
+// Read reads the body, recording a limit error.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+
+	return n, err
+}
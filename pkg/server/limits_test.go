@@ -0,0 +1,136 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// handleUpload registers the "/upload" and "/ignore" routes behind the
+// "upload" request limit.
+func handleUpload(s *server.Server) {
+	limit := s.RequestLimit("upload", server.RequestLimitConfig{
+		Timeout:      20 * time.Millisecond,
+		MaxBodyBytes: 8,
+	})
+	s.Handle("/upload", limit(s.Handler(
+		func(w http.ResponseWriter, req *http.Request) error {
+			if _, err := io.ReadAll(req.Body); err != nil {
+				return err
+			}
+
+			if req.URL.Query().Has("slow") {
+				<-req.Context().Done()
+				return req.Context().Err()
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		})))
+	s.Handle("/ignore", limit(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(30 * time.Millisecond)
+		})))
+}
+
+// upload sends the body to the path.
+func upload(s *server.Server, path string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequestLimit(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleUpload(s)
+
+	// when
+	rec := upload(s, "/upload", strings.NewReader("small"))
+
+	// then
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestRequestLimit_withLargeBody(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleUpload(s)
+
+	// when
+	recKnown := upload(s, "/upload", strings.NewReader("too large body"))
+
+	// the body size is only known once read
+	recStreamed := upload(s, "/upload",
+		io.MultiReader(strings.NewReader("too large body")))
+
+	// then
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recKnown.Code)
+	assert.Equal(t, "application/problem+json",
+		recKnown.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recStreamed.Code)
+	assert.Contains(t, recStreamed.Body.String(), "exceeds 8 bytes")
+	assert.Equal(t, `{"upload": 2}`,
+		s.Metrics().Get("request_too_large").String())
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestRequestLimit_withTimeout(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleUpload(s)
+
+	// when
+	recReturned := upload(s, "/upload?slow", &bytes.Buffer{})
+	recIgnored := upload(s, "/ignore", &bytes.Buffer{})
+
+	// then
+	assert.Equal(t, http.StatusServiceUnavailable, recReturned.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, recIgnored.Code)
+	assert.Contains(t, recIgnored.Body.String(), "the request timed out")
+	assert.Equal(t, `{"upload": 2}`,
+		s.Metrics().Get("request_timeouts").String())
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestWriteError_withDeadlineOfParent(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	fpGiven.On("Report", mock.Anything).Return()
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+
+	// the deadline of a downstream call is a server error
+	handler := s.Handler(func(w http.ResponseWriter, req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	// when
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	fpGiven.AssertCalled(t, "Report", mock.Anything)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server/correlation"
+)
+
+// The Cloud Logging special fields of the structured log entries.
+const (
+	severityKey = "severity"
+	messageKey  = "message"
+	traceKey    = "logging.googleapis.com/trace"
+	spanKey     = "logging.googleapis.com/spanId"
+	requestKey  = "requestId"
+	labelsKey   = "logging.googleapis.com/labels"
+)
+
+// newStructuredLogger creates a structured logger writing to w. It writes
+// text in Development, and Cloud Logging JSON entries on a Cloud environment.
+// The correlation identifiers found in the context of the log calls are added
+// to the entries, as well as the service version, as a Cloud Logging label.
+func newStructuredLogger(
+	w io.Writer, environment config.Environment,
+	projectID, version string) *slog.Logger {
+
+	var handler slog.Handler
+	if environment.OnCloud() {
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
+			ReplaceAttr: cloudLoggingAttr,
+		})
+	} else {
+		handler = slog.NewTextHandler(w, nil)
+	}
+
+	if version != "" {
+		versionAttr := slog.String("version", version)
+		if environment.OnCloud() {
+			versionAttr = slog.Group(labelsKey, versionAttr)
+		}
+		handler = handler.WithAttrs([]slog.Attr{versionAttr})
+	}
+
+	return slog.New(&contextHandler{
+		Handler:   handler,
+		projectID: projectID,
+	})
+}
+
+// cloudLoggingAttr renames the default slog attributes to the Cloud Logging
+// special fields.
+func cloudLoggingAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+
+	switch a.Key {
+	case slog.MessageKey:
+		a.Key = messageKey
+	case slog.LevelKey:
+		a.Key = severityKey
+		a.Value = slog.StringValue(severity(a.Value.Any().(slog.Level)))
+	}
+
+	return a
+}
+
+// severity returns the Cloud Logging severity of the level.
+func severity(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// contextHandler is a slog.Handler adding the correlation identifiers stored
+// in the context to the records.
+type contextHandler struct {
+	slog.Handler
+
+	projectID string // the project of the traces, if known
+}
+
+// Handle adds the request and trace identifiers to the record.
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ids, ok := correlation.FromContext(ctx); ok {
+		r.AddAttrs(slog.String(requestKey, ids.RequestID))
+
+		if ids.TraceID != "" {
+			trace := ids.TraceID
+			if h.projectID != "" {
+				trace = "projects/" + h.projectID + "/traces/" + trace
+			}
+			r.AddAttrs(slog.String(traceKey, trace))
+		}
+
+		if ids.SpanID != "" {
+			r.AddAttrs(slog.String(spanKey, ids.SpanID))
+		}
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a contextHandler wrapping the handler with the attributes.
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{
+		Handler:   h.Handler.WithAttrs(attrs),
+		projectID: h.projectID,
+	}
+}
+
+// WithGroup returns a contextHandler wrapping the handler with the group.
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{
+		Handler:   h.Handler.WithGroup(name),
+		projectID: h.projectID,
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server/correlation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStructuredLogger_onCloud(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{
+		RequestID: "request-id",
+		TraceID:   "trace-id",
+		SpanID:    "00f067aa0ba902b7",
+	})
+
+	// when
+	logger := newStructuredLogger(&output, config.Production, "project-id", "v1.2.3")
+	logger.WarnContext(ctx, "something happened", "key", "value")
+
+	var entry map[string]any
+	err := json.Unmarshal(output.Bytes(), &entry)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "WARNING", entry[severityKey])
+	assert.Equal(t, "something happened", entry[messageKey])
+	assert.Equal(t, "value", entry["key"])
+	assert.Equal(t, "request-id", entry[requestKey])
+	assert.Equal(t, "projects/project-id/traces/trace-id", entry[traceKey])
+	assert.Equal(t, "00f067aa0ba902b7", entry[spanKey])
+	assert.Equal(t, map[string]any{"version": "v1.2.3"}, entry[labelsKey])
+}
+
+func TestNewStructuredLogger_withoutRequest(t *testing.T) {
+	// given
+	var output bytes.Buffer
+
+	// when
+	logger := newStructuredLogger(&output, config.Production, "", "")
+	logger.With("key", "value").Info("no request")
+
+	var entry map[string]any
+	err := json.Unmarshal(output.Bytes(), &entry)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "INFO", entry[severityKey])
+	assert.Equal(t, "value", entry["key"])
+	assert.NotContains(t, entry, requestKey)
+	assert.NotContains(t, entry, traceKey)
+	assert.NotContains(t, entry, labelsKey)
+}
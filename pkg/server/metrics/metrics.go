@@ -0,0 +1,119 @@
+// Package metrics provides a registry of [expvar] variables, scoped to a
+// server instead of the process.
+//
+// The variables are not published into the global [expvar] registry, so
+// several servers can live in the same process. The registry itself is an
+// [expvar.Var] and an [http.Handler] serving the variables as JSON.
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry holds named metrics.
+type Registry struct {
+	mu   sync.Mutex            // guards vars
+	vars map[string]expvar.Var // the metrics by name
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		vars: make(map[string]expvar.Var),
+	}
+}
+
+// Counter returns the named integer metric, creating it if needed.
+// It panics if the name is used by a metric of another type.
+func (r *Registry) Counter(name string) *expvar.Int {
+	return getOrCreate(r, name, new(expvar.Int))
+}
+
+// Float returns the named float metric, creating it if needed.
+// It panics if the name is used by a metric of another type.
+func (r *Registry) Float(name string) *expvar.Float {
+	return getOrCreate(r, name, new(expvar.Float))
+}
+
+// Map returns the named labeled metric, creating it if needed. The map keys
+// are the labels.
+// It panics if the name is used by a metric of another type.
+func (r *Registry) Map(name string) *expvar.Map {
+	return getOrCreate(r, name, new(expvar.Map).Init())
+}
+
+// Func registers a metric computed when read, such as a queue depth.
+// An existing metric with the same name is replaced.
+func (r *Registry) Func(name string, f func() any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.vars[name] = expvar.Func(f)
+}
+
+// Get returns the named metric, or nil.
+func (r *Registry) Get(name string) expvar.Var {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.vars[name]
+}
+
+// String returns the metrics as a JSON object, sorted by name.
+func (r *Registry) String() string {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.vars))
+	vars := make(map[string]expvar.Var, len(r.vars))
+	for name, v := range r.vars {
+		names = append(names, name)
+		vars[name] = v
+	}
+	r.mu.Unlock()
+
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+
+		key, _ := json.Marshal(name)
+		fmt.Fprintf(&b, "%s:%s", key, vars[name].String())
+	}
+	b.WriteString("}")
+
+	return b.String()
+}
+
+// ServeHTTP serves the metrics as JSON.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprint(w, r.String())
+}
+
+// getOrCreate returns the named metric of type T, or registers v under the
+// name.
+func getOrCreate[T expvar.Var](r *Registry, name string, v T) T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.vars[name]; ok {
+		typed, ok := existing.(T)
+		if !ok {
+			panic(fmt.Sprintf("metrics: %s already registered as %T", name, existing))
+		}
+
+		return typed
+	}
+
+	r.vars[name] = v
+	return v
+}
@@ -0,0 +1,59 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/server/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	// given
+	r := metrics.NewRegistry()
+
+	// when
+	r.Counter("requests").Add(2)
+	r.Counter("requests").Add(1)
+	r.Float("latency").Set(0.5)
+	r.Map("codes").Add("OK", 1)
+	r.Func("depth", func() any { return 7 })
+
+	var actual map[string]any
+	err := json.Unmarshal([]byte(r.String()), &actual)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{
+		"requests": 3.0,
+		"latency":  0.5,
+		"codes":    map[string]any{"OK": 1.0},
+		"depth":    7.0,
+	}, actual)
+	assert.Nil(t, r.Get("missing"))
+}
+
+func TestRegistry_withTypeMismatch(t *testing.T) {
+	// given
+	r := metrics.NewRegistry()
+	r.Counter("requests")
+
+	// when / then
+	assert.Panics(t, func() { r.Map("requests") })
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	// given
+	r := metrics.NewRegistry()
+	r.Counter("requests").Add(1)
+
+	// when
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// then
+	assert.Equal(t, `{"requests":1}`, rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/json")
+}
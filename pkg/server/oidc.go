@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+// TokenValidator validates a Google-signed OIDC token for the audience.
+// [idtoken.Validate] is the default validator.
+type TokenValidator func(
+	ctx context.Context, token, audience string) (*idtoken.Payload, error)
+
+// OIDCConfig configures the verification of the OIDC tokens sent by Google
+// services calling the server, such as Pub/Sub push subscriptions, Cloud
+// Tasks or Cloud Scheduler.
+type OIDCConfig struct {
+	// Audience is the expected token audience. It defaults to the URL of the
+	// request, which is the default audience set by the Google services.
+	Audience string
+	// ServiceAccount is the expected token email. It is required on a Cloud
+	// environment, as any Google account can get a token for the audience.
+	ServiceAccount string
+	// Validator validates the token signature. It defaults to
+	// [idtoken.Validate].
+	Validator TokenValidator
+}
+
+// checkOIDC fails if the tokens cannot be verified: on a Cloud environment,
+// the service account is required.
+func (s *Server) checkOIDC(c OIDCConfig) error {
+	if s.cfg.Environment().OnCloud() && c.ServiceAccount == "" {
+		return fmt.Errorf("missing OIDC service account")
+	}
+
+	return nil
+}
+
+// verifyOIDC checks the bearer token of the request. The tokens are only
+// verified on a Cloud environment.
+func (s *Server) verifyOIDC(req *http.Request, c OIDCConfig) error {
+	if !s.cfg.Environment().OnCloud() {
+		return nil
+	}
+
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return Unauthenticated("missing bearer token", nil)
+	}
+
+	audience := c.Audience
+	if audience == "" {
+		audience = "https://" + req.Host + req.URL.Path
+	}
+
+	validate := c.Validator
+	if validate == nil {
+		validate = idtoken.Validate
+	}
+
+	payload, err := validate(req.Context(), token, audience)
+	if err != nil {
+		return Unauthenticated("invalid bearer token", err)
+	}
+
+	email, _ := payload.Claims["email"].(string)
+	verified, _ := payload.Claims["email_verified"].(bool)
+	if !verified {
+		return PermissionDenied("unverified token email", nil)
+	}
+
+	if email != c.ServiceAccount {
+		return PermissionDenied("unexpected token email",
+			fmt.Errorf("got %s, expected %s", email, c.ServiceAccount))
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/planetfall/framework/pkg/server/flags"
+	"google.golang.org/grpc"
+)
+
+// The default values of the server options.
+const (
+	defaultLogFlags        = log.Ldate | log.Ltime
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+// Option configures a Server created by [NewServer].
+// Options returns an error when given an invalid value, or when they
+// conflict with another option.
+type Option func(o *options) error
+
+// options holds the values set by the options.
+type options struct {
+	logger          *log.Logger              // the custom logger
+	output          io.Writer                // the log output
+	logFlags        *int                     // the log flags
+	featureProvider features.FeatureProvider // the custom feature provider
+	middleware      []Middleware             // the HTTP middleware
+	shutdownTimeout time.Duration            // the maximum time to close
+	version         string                   // the service version
+	grpcOptions     []grpc.ServerOption      // the custom gRPC server options
+	multiplexed     bool                     // serve gRPC along HTTP
+	flags           *flags.Set               // the feature flags
+}
+
+// newOptions applies the options over the default values and checks the
+// conflicts between them.
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.logger != nil && (o.output != nil || o.logFlags != nil) {
+		return nil, fmt.Errorf(
+			"WithLogger conflicts with WithOutput and WithLogFlags")
+	}
+
+	if o.output == nil {
+		o.output = os.Stdout
+	}
+
+	if o.logFlags == nil {
+		flags := defaultLogFlags
+		o.logFlags = &flags
+	}
+
+	return o, nil
+}
+
+// WithLogger sets the server logger, instead of the one created using the
+// service name. It conflicts with WithOutput and WithLogFlags.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) error {
+		if logger == nil {
+			return fmt.Errorf("WithLogger: nil logger")
+		}
+		if o.logger != nil {
+			return fmt.Errorf("WithLogger: logger already set")
+		}
+
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithOutput sets the writer the server logs to. It defaults to [os.Stdout].
+func WithOutput(output io.Writer) Option {
+	return func(o *options) error {
+		if output == nil {
+			return fmt.Errorf("WithOutput: nil output")
+		}
+		if o.output != nil {
+			return fmt.Errorf("WithOutput: output already set")
+		}
+
+		o.output = output
+		return nil
+	}
+}
+
+// WithLogFlags sets the [log] flags of the server logger. It defaults to
+// the date and the time.
+func WithLogFlags(flags int) Option {
+	return func(o *options) error {
+		if o.logFlags != nil {
+			return fmt.Errorf("WithLogFlags: log flags already set")
+		}
+
+		o.logFlags = &flags
+		return nil
+	}
+}
+
+// WithFeatureProvider sets a custom feature provider, used instead of the
+// default provider when running on a Cloud environment.
+func WithFeatureProvider(featureProvider features.FeatureProvider) Option {
+	return func(o *options) error {
+		if featureProvider == nil {
+			return fmt.Errorf("WithFeatureProvider: nil provider")
+		}
+		if o.featureProvider != nil {
+			return fmt.Errorf("WithFeatureProvider: provider already set")
+		}
+
+		o.featureProvider = featureProvider
+		return nil
+	}
+}
+
+// WithMiddleware adds middleware wrapping the handlers registered on the
+// server. The first middleware given is the outermost one. The panics of the
+// middleware are recovered as the ones of the handlers.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(o *options) error {
+		for _, m := range middleware {
+			if m == nil {
+				return fmt.Errorf("WithMiddleware: nil middleware")
+			}
+		}
+
+		o.middleware = append(o.middleware, middleware...)
+		return nil
+	}
+}
+
+// WithShutdownTimeout sets the maximum time given to the server to stop
+// serving and close its features. It defaults to 10 seconds.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("WithShutdownTimeout: invalid timeout %s", timeout)
+		}
+
+		o.shutdownTimeout = timeout
+		return nil
+	}
+}
+
+// WithVersion sets the version of the service.
+func WithVersion(version string) Option {
+	return func(o *options) error {
+		if version == "" {
+			return fmt.Errorf("WithVersion: empty version")
+		}
+		if o.version != "" {
+			return fmt.Errorf("WithVersion: version already set")
+		}
+
+		o.version = version
+		return nil
+	}
+}
+
+// WithGRPCOptions adds options to the gRPC server returned by [Server.GRPC].
+// The interceptors given are run after the server interceptors.
+func WithGRPCOptions(grpcOptions ...grpc.ServerOption) Option {
+	return func(o *options) error {
+		o.grpcOptions = append(o.grpcOptions, grpcOptions...)
+		return nil
+	}
+}
+
+// WithMultiplexing makes [Server.ListenAndServe] serve both the registered
+// HTTP handlers and the gRPC server on the same port, using HTTP/2
+// cleartext. It allows to expose both on a single Cloud Run service.
+func WithMultiplexing() Option {
+	return func(o *options) error {
+		o.multiplexed = true
+		return nil
+	}
+}
+
+// WithFlags sets the feature flags returned by [Server.Flags]. Their
+// evaluations are exported in the "flag_evaluations" metric, and their
+// overrides are reloaded when the config file changes, the reload errors
+// being raised.
+func WithFlags(set *flags.Set) Option {
+	return func(o *options) error {
+		if set == nil {
+			return fmt.Errorf("WithFlags: nil flags")
+		}
+		if o.flags != nil {
+			return fmt.Errorf("WithFlags: flags already set")
+		}
+
+		o.flags = set
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/planetfall/framework/pkg/server/flags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServer_withOptions(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	outputGiven := &bytes.Buffer{}
+	versionGiven := "v1.2.3"
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithOutput(outputGiven),
+		server.WithLogFlags(0),
+		server.WithShutdownTimeout(time.Second),
+		server.WithVersion(versionGiven))
+
+	// then
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+	assert.Equal(t, versionGiven, s.Version())
+	assert.Contains(t, outputGiven.String(), "running version "+versionGiven)
+	cfgGiven.AssertExpectations(t)
+}
+
+func TestNewServer_withLogger(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	outputGiven := &bytes.Buffer{}
+	loggerGiven := log.New(outputGiven, "custom - ", 0)
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithLogger(loggerGiven))
+
+	// then
+	assert.Nil(t, err)
+	assert.Same(t, loggerGiven, s.Logger)
+	assert.Contains(t, outputGiven.String(), "custom - setting up the server")
+	cfgGiven.AssertExpectations(t)
+}
+
+func TestNewServer_withInvalidOptions_shouldFail(t *testing.T) {
+	testCases := map[string][]server.Option{
+		"logger and output": {
+			server.WithLogger(log.Default()),
+			server.WithOutput(&bytes.Buffer{}),
+		},
+		"output and logger": {
+			server.WithOutput(&bytes.Buffer{}),
+			server.WithLogger(log.Default()),
+		},
+		"logger and flags": {
+			server.WithLogFlags(0),
+			server.WithLogger(log.Default()),
+		},
+		"two providers": {
+			server.WithFeatureProvider(&featureProviderMock{}),
+			server.WithFeatureProvider(&featureProviderMock{}),
+		},
+		"nil provider":     {server.WithFeatureProvider(nil)},
+		"nil logger":       {server.WithLogger(nil)},
+		"nil middleware":   {server.WithMiddleware(nil)},
+		"negative timeout": {server.WithShutdownTimeout(-time.Second)},
+		"empty version":    {server.WithVersion("")},
+		"nil flags":        {server.WithFlags(nil)},
+	}
+
+	for name, optsGiven := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// given
+			var cfgGiven = &configMock{}
+			serviceGiven := "service-name"
+
+			// when
+			s, err := server.NewServer(
+				context.Background(), cfgGiven, serviceGiven, optsGiven...)
+
+			// then
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), "newOptions")
+			assert.Nil(t, s)
+		})
+	}
+}
+
+func TestNewServer_withFlags(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	flagsGiven, err := flags.NewSet(config.Development,
+		flags.Flag{Name: "checkout", DefaultValue: "true"})
+	assert.Nil(t, err)
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Development)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, "service-name",
+		server.WithOutput(&bytes.Buffer{}),
+		server.WithFlags(flagsGiven))
+	assert.Nil(t, err)
+
+	enabled := s.Flags().Enabled("checkout", "user-1")
+
+	// then
+	assert.Same(t, flagsGiven, s.Flags())
+	assert.True(t, enabled)
+	assert.JSONEq(t, `{"checkout:on": 1}`,
+		s.Metrics().Get("flag_evaluations").String())
+}
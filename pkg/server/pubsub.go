@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PushMessage is a Pub/Sub message received from a push subscription.
+type PushMessage struct {
+	ID              string            // the message identifier
+	Data            []byte            // the decoded message data
+	Attributes      map[string]string // the message attributes
+	OrderingKey     string            // the ordering key, if any
+	PublishTime     time.Time         // the time the message was published
+	DeliveryAttempt int               // the delivery attempt, 0 if unknown
+	Subscription    string            // the subscription full name
+}
+
+// PushHandler processes a Pub/Sub push message.
+//
+// Returning nil acknowledges the message. Returning an [*Error] with a client
+// kind, such as [InvalidArgument], marks the message as poison: it is raised
+// and acknowledged as retrying would fail again. Any other error makes the
+// message redelivered.
+type PushHandler func(ctx context.Context, msg *PushMessage) error
+
+// PushConfig configures a Pub/Sub push endpoint.
+type PushConfig struct {
+	// OIDC configures the verification of the push authentication token.
+	OIDC OIDCConfig
+	// MaxDeliveryAttempts is the number of delivery attempts after which a
+	// failing message is considered poison and raised, typically the dead
+	// letter policy attempts. The failures are only logged before. Every
+	// failure is raised when 0.
+	MaxDeliveryAttempts int
+}
+
+// pushEnvelope is the body of a Pub/Sub push request.
+type pushEnvelope struct {
+	Message struct {
+		Data        []byte            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageID   string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+		OrderingKey string            `json:"orderingKey"`
+	} `json:"message"`
+	Subscription    string `json:"subscription"`
+	DeliveryAttempt int    `json:"deliveryAttempt"`
+}
+
+// HandlePush registers a Pub/Sub push endpoint for the given pattern.
+// The push token is verified, the envelope decoded and the message given to
+// the handler, whose error is mapped to an acknowledgement status code.
+// It fails on a Cloud environment if the OIDC service account is not set.
+func (s *Server) HandlePush(
+	pattern string, handler PushHandler, cfg PushConfig) error {
+
+	if err := s.checkOIDC(cfg.OIDC); err != nil {
+		return fmt.Errorf("checkOIDC: %v", err)
+	}
+
+	s.Handle(pattern, s.Handler(func(w http.ResponseWriter, req *http.Request) error {
+		if req.Method != http.MethodPost {
+			return InvalidArgument("push requests must use POST", nil)
+		}
+
+		if err := s.verifyOIDC(req, cfg.OIDC); err != nil {
+			return err
+		}
+
+		// an envelope that cannot be decoded never will, it is acknowledged
+		var envelope pushEnvelope
+		if err := json.NewDecoder(req.Body).Decode(&envelope); err != nil {
+			err = InvalidArgument("invalid push envelope", err)
+			s.Raise("poison push message", err, req)
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		msg := &PushMessage{
+			ID:              envelope.Message.MessageID,
+			Data:            envelope.Message.Data,
+			Attributes:      envelope.Message.Attributes,
+			OrderingKey:     envelope.Message.OrderingKey,
+			PublishTime:     envelope.Message.PublishTime,
+			DeliveryAttempt: envelope.DeliveryAttempt,
+			Subscription:    envelope.Subscription,
+		}
+
+		err := handler(req.Context(), msg)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		message := fmt.Sprintf("push message %s", msg.ID)
+
+		// poison messages are acknowledged, redelivering them is pointless
+		var appErr *Error
+		if errors.As(err, &appErr) &&
+			appErr.Kind.Status() < http.StatusInternalServerError {
+
+			s.Raise("poison "+message, err, req)
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		if cfg.MaxDeliveryAttempts == 0 ||
+			msg.DeliveryAttempt >= cfg.MaxDeliveryAttempts {
+			return err
+		}
+
+		// the failure is only logged, the message is redelivered
+		s.StructuredLogger.WarnContext(req.Context(),
+			fmt.Sprintf("%s failed: %v", message, err),
+			"deliveryAttempt", msg.DeliveryAttempt)
+		writeProblem(w, req, http.StatusServiceUnavailable, "")
+		return nil
+	}))
+
+	return nil
+}
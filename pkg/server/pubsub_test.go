@@ -0,0 +1,215 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/api/idtoken"
+)
+
+const pushBodyGiven = `{
+	"message": {
+		"data": "aGVsbG8=",
+		"attributes": {"key": "value"},
+		"messageId": "message-id",
+		"publishTime": "2023-10-01T10:00:00Z",
+		"orderingKey": "ordering-key"
+	},
+	"subscription": "projects/project/subscriptions/subscription",
+	"deliveryAttempt": 1
+}`
+
+// validatorStub accepts the "valid" token with the given email.
+func validatorStub(email string) server.TokenValidator {
+	return func(
+		_ context.Context, token, audience string) (*idtoken.Payload, error) {
+
+		if token != "valid" {
+			return nil, fmt.Errorf("invalid token")
+		}
+
+		return &idtoken.Payload{
+			Audience: audience,
+			Claims: map[string]any{
+				"email":          email,
+				"email_verified": true,
+			},
+		}, nil
+	}
+}
+
+// handlePush registers a push endpoint calling the handler.
+func handlePush(t *testing.T, s *server.Server, handler server.PushHandler) {
+	err := s.HandlePush("/push", handler, server.PushConfig{
+		OIDC: server.OIDCConfig{
+			ServiceAccount: "pubsub@project.iam.gserviceaccount.com",
+			Validator:      validatorStub("pubsub@project.iam.gserviceaccount.com"),
+		},
+		MaxDeliveryAttempts: 5,
+	})
+	assert.Nil(t, err)
+}
+
+// push sends the body to the push endpoint with the token.
+func push(s *server.Server, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/push", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlePush(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	var msgActual *server.PushMessage
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handlePush(t, s,
+		func(ctx context.Context, msg *server.PushMessage) error {
+			msgActual = msg
+			return nil
+		})
+
+	// when
+	rec := push(s, "valid", pushBodyGiven)
+
+	// then
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "message-id", msgActual.ID)
+	assert.Equal(t, []byte("hello"), msgActual.Data)
+	assert.Equal(t, map[string]string{"key": "value"}, msgActual.Attributes)
+	assert.Equal(t, "ordering-key", msgActual.OrderingKey)
+	assert.Equal(t, 2023, msgActual.PublishTime.Year())
+	assert.Equal(t, 1, msgActual.DeliveryAttempt)
+	assert.Equal(t, "projects/project/subscriptions/subscription",
+		msgActual.Subscription)
+	fpGiven.AssertExpectations(t)
+}
+
+func TestHandlePush_withInvalidToken(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handlePush(t, s,
+		func(ctx context.Context, msg *server.PushMessage) error {
+			return nil
+		})
+
+	// when
+	recMissing := push(s, "", pushBodyGiven)
+	recInvalid := push(s, "invalid", pushBodyGiven)
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, recMissing.Code)
+	assert.Equal(t, http.StatusUnauthorized, recInvalid.Code)
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestHandlePush_withoutServiceAccount_shouldFail(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handlePush(t, s, func(context.Context, *server.PushMessage) error {
+		return nil
+	})
+
+	// when
+	err = s.HandlePush("/other", func(context.Context, *server.PushMessage) error {
+		return nil
+	}, server.PushConfig{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "service account")
+}
+
+func TestHandlePush_withPoisonMessage(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	fpGiven.On("Report", mock.Anything).Return()
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handlePush(t, s,
+		func(ctx context.Context, msg *server.PushMessage) error {
+			return server.InvalidArgument("unexpected payload", nil)
+		})
+
+	// when
+	rec := push(s, "valid", pushBodyGiven)
+
+	// then
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	fpGiven.AssertExpectations(t)
+}
+
+func TestHandlePush_withMalformedEnvelope(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	fpGiven.On("Report", mock.Anything).Return()
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handlePush(t, s,
+		func(ctx context.Context, msg *server.PushMessage) error {
+			return nil
+		})
+
+	// when
+	rec := push(s, "valid", "{not json")
+
+	// then
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	fpGiven.AssertExpectations(t)
+}
+
+func TestHandlePush_withTransientError(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handlePush(t, s,
+		func(ctx context.Context, msg *server.PushMessage) error {
+			return fmt.Errorf("database unavailable")
+		})
+
+	// when
+	rec := push(s, "valid", pushBodyGiven)
+
+	// then
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestHandlePush_withLastAttempt(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	fpGiven.On("Report", mock.Anything).Return()
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handlePush(t, s,
+		func(ctx context.Context, msg *server.PushMessage) error {
+			return fmt.Errorf("database unavailable")
+		})
+
+	// when
+	body := strings.Replace(pushBodyGiven,
+		`"deliveryAttempt": 1`, `"deliveryAttempt": 5`, 1)
+	rec := push(s, "valid", body)
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	fpGiven.AssertExpectations(t)
+}
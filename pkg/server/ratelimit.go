@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyFunc returns the key a request is rate limited by, such as the client
+// address.
+type KeyFunc func(req *http.Request) string
+
+// KeyByIP limits the requests by client address.
+func KeyByIP(req *http.Request) string {
+	return clientIP(req)
+}
+
+// KeyByHeader limits the requests by the value of the header, such as an API
+// key. The requests without the header are limited by client address.
+func KeyByHeader(name string) KeyFunc {
+	return func(req *http.Request) string {
+		if value := req.Header.Get(name); value != "" {
+			return name + ":" + value
+		}
+
+		return KeyByIP(req)
+	}
+}
+
+// KeyByPrincipal limits the requests by authenticated principal, set by an
+// authentication middleware with [NewPrincipalContext]. The anonymous
+// requests are limited by client address.
+func KeyByPrincipal(req *http.Request) string {
+	if principal, ok := PrincipalFromContext(req.Context()); ok {
+		return "principal:" + principal
+	}
+
+	return KeyByIP(req)
+}
+
+// principalKey is the context key of the authenticated principal.
+type principalKey struct{}
+
+// NewPrincipalContext returns a context holding the authenticated principal,
+// such as a user identifier or a service account email.
+func NewPrincipalContext(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated principal, if any.
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
+
+// RateLimitConfig configures a token bucket rate limit.
+type RateLimitConfig struct {
+	// Rate is the number of requests per second allowed in the long run.
+	Rate float64
+	// Burst is the number of requests allowed at once. It defaults to the
+	// rate, rounded up.
+	Burst int
+	// Key returns the key the requests are limited by. It defaults to
+	// [KeyByIP].
+	Key KeyFunc
+}
+
+// The limiter buckets are swept of the full ones at this interval, and are
+// at most this many. When there are too many keys, arbitrary buckets are
+// evicted.
+const (
+	rateLimitSweep      = time.Minute
+	rateLimitMaxBuckets = 10000
+)
+
+// bucket is a token bucket.
+type bucket struct {
+	tokens float64   // the available tokens
+	last   time.Time // the time the tokens were computed
+}
+
+// rateLimiter holds the token buckets of a rate limit, by key.
+type rateLimiter struct {
+	name string          // the limit name, used as metrics label
+	cfg  RateLimitConfig // the limit configuration
+
+	mu         sync.Mutex         // guards the fields below
+	buckets    map[string]*bucket // the buckets by key
+	maxBuckets int                // the maximum number of buckets
+	swept      time.Time          // the last time the full buckets were removed
+}
+
+// newRateLimiter creates a rate limiter, applying the config defaults.
+func newRateLimiter(name string, cfg RateLimitConfig) *rateLimiter {
+	if cfg.Burst <= 0 {
+		cfg.Burst = int(math.Ceil(cfg.Rate))
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyByIP
+	}
+
+	return &rateLimiter{
+		name:       name,
+		cfg:        cfg,
+		buckets:    make(map[string]*bucket),
+		maxBuckets: rateLimitMaxBuckets,
+		swept:      time.Now(),
+	}
+}
+
+// allow takes a token from the key bucket. When no token is available, it
+// returns the time until the next one.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.swept) > rateLimitSweep {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.maxBuckets {
+			l.sweep(now)
+		}
+		for k := range l.buckets {
+			if len(l.buckets) < l.maxBuckets {
+				break
+			}
+			delete(l.buckets, k)
+		}
+
+		b = &bucket{tokens: float64(l.cfg.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.cfg.Burst),
+		b.tokens+now.Sub(b.last).Seconds()*l.cfg.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.cfg.Rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep removes the buckets refilled since their last use: they are the same
+// as new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(float64(l.cfg.Burst) / l.cfg.Rate * float64(time.Second))
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, k)
+		}
+	}
+	l.swept = now
+}
+
+// RateLimit returns a middleware limiting the requests with a token bucket
+// per key. The rejected requests get a 429 problem with a Retry-After
+// header. The decisions are counted in the "rate_limit_allowed" and
+// "rate_limit_rejected" metrics, labeled with the name.
+//
+// A limit set from the config entries applies to every route, see
+// [RateLimitEntry]. This middleware is meant for the routes with their own
+// limit, such as:
+//
+//	s.Handle("/search", s.RateLimit("search", cfg)(handler))
+//
+// It panics if the rate is not positive.
+func (s *Server) RateLimit(name string, cfg RateLimitConfig) Middleware {
+	if cfg.Rate <= 0 {
+		panic(fmt.Sprintf("server: invalid rate limit %s rate %v", name, cfg.Rate))
+	}
+
+	limiter := newRateLimiter(name, cfg)
+	return s.rateLimit(func(*http.Request) *rateLimiter { return limiter })
+}
+
+// rateLimit returns a middleware applying the limiter of the request. A nil
+// limiter does not limit.
+func (s *Server) rateLimit(limiterOf func(req *http.Request) *rateLimiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			limiter := limiterOf(req)
+			if limiter == nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			allowed, wait := limiter.allow(limiter.cfg.Key(req), time.Now())
+			if !allowed {
+				s.metrics.Map("rate_limit_rejected").Add(limiter.name, 1)
+
+				retryAfter := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeProblem(w, req, http.StatusTooManyRequests, "")
+				return
+			}
+
+			s.metrics.Map("rate_limit_allowed").Add(limiter.name, 1)
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// routeRateLimits holds the rate limits set from the config entries.
+type routeRateLimits struct {
+	fallback *rateLimiter            // the limit of every route, if any
+	routes   map[string]*rateLimiter // the limits by route pattern
+}
+
+// newRouteRateLimits creates the rate limits from the config entries. It
+// returns nil if no limit is set.
+func newRouteRateLimits() (*routeRateLimits, error) {
+	key, err := parseRateLimitKey(RateLimitKeyEntry.Value())
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value: %v", RateLimitKeyEntry.Flag, err)
+	}
+
+	limits := &routeRateLimits{routes: make(map[string]*rateLimiter)}
+
+	if value := RateLimitEntry.Value(); value != "" {
+		cfg, err := parseRateLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value: %v", RateLimitEntry.Flag, err)
+		}
+		cfg.Key = key
+		limits.fallback = newRateLimiter("*", cfg)
+	}
+
+	for _, item := range RateLimitRoutesEntry.Values() {
+		pattern, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s item %q",
+				RateLimitRoutesEntry.Flag, item)
+		}
+
+		cfg, err := parseRateLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s item %q: %v",
+				RateLimitRoutesEntry.Flag, item, err)
+		}
+		cfg.Key = key
+		limits.routes[pattern] = newRateLimiter(pattern, cfg)
+	}
+
+	if limits.fallback == nil && len(limits.routes) == 0 {
+		return nil, nil
+	}
+
+	return limits, nil
+}
+
+// limiter returns the limiter of the request route. The routes are matched
+// like the [http.ServeMux] patterns without host: a pattern ending with a
+// slash matches the paths it prefixes, the longest pattern winning.
+func (l *routeRateLimits) limiter(req *http.Request) *rateLimiter {
+	path := req.URL.Path
+	if limiter, ok := l.routes[path]; ok {
+		return limiter
+	}
+
+	var match *rateLimiter
+	matchLength := 0
+	for pattern, limiter := range l.routes {
+		if strings.HasSuffix(pattern, "/") &&
+			strings.HasPrefix(path, pattern) && len(pattern) > matchLength {
+
+			match, matchLength = limiter, len(pattern)
+		}
+	}
+
+	if match != nil {
+		return match
+	}
+
+	return l.fallback
+}
+
+// parseRateLimit parses a "rate" or "rate:burst" limit, the rate being in
+// requests per second.
+func parseRateLimit(value string) (RateLimitConfig, error) {
+	rateValue, burstValue, hasBurst := strings.Cut(value, ":")
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rateValue), 64)
+	if err != nil || rate <= 0 {
+		return RateLimitConfig{}, fmt.Errorf("invalid rate %q", rateValue)
+	}
+
+	cfg := RateLimitConfig{Rate: rate}
+	if hasBurst {
+		burst, err := strconv.Atoi(strings.TrimSpace(burstValue))
+		if err != nil || burst <= 0 {
+			return RateLimitConfig{}, fmt.Errorf("invalid burst %q", burstValue)
+		}
+		cfg.Burst = burst
+	}
+
+	return cfg, nil
+}
+
+// parseRateLimitKey returns the key function named by the value: "ip",
+// "principal" or "header:<name>".
+func parseRateLimitKey(value string) (KeyFunc, error) {
+	switch {
+	case value == "ip":
+		return KeyByIP, nil
+	case value == "principal":
+		return KeyByPrincipal, nil
+	case strings.HasPrefix(value, "header:") && len(value) > len("header:"):
+		return KeyByHeader(strings.TrimPrefix(value, "header:")), nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", value)
+}
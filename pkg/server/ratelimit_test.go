@@ -0,0 +1,181 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// get sends a GET request for the path from the client address.
+func get(s *server.Server, path, clientIP string, header http.Header) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Forwarded-For", clientIP)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// handleStatus registers a handler answering with the status.
+func handleStatus(s *server.Server, pattern string, status int) {
+	s.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	// given
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(&bytes.Buffer{}))
+	assert.Nil(t, err)
+	s.Handle("/search", s.RateLimit("search", server.RateLimitConfig{
+		Rate:  0.5,
+		Burst: 2,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	// when
+	first := get(s, "/search", "10.0.0.1", nil)
+	second := get(s, "/search", "10.0.0.1", nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/search", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	rejected := httptest.NewRecorder()
+	s.ServeHTTP(rejected, req)
+
+	other := get(s, "/search", "10.0.0.2", nil)
+
+	// then
+	assert.Equal(t, http.StatusNoContent, first)
+	assert.Equal(t, http.StatusNoContent, second)
+	assert.Equal(t, http.StatusTooManyRequests, rejected.Code)
+	assert.Equal(t, "2", rejected.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json",
+		rejected.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusNoContent, other)
+	assert.Equal(t, `{"search": 3}`,
+		s.Metrics().Get("rate_limit_allowed").String())
+	assert.Equal(t, `{"search": 1}`,
+		s.Metrics().Get("rate_limit_rejected").String())
+}
+
+func TestRateLimit_withEntries(t *testing.T) {
+	// given
+	s, err := newTestServer(t, config.Development, nil, map[string]string{
+		server.RateLimitEntry.Flag:       "1",
+		server.RateLimitRoutesEntry.Flag: "/fail=1:3",
+		server.RateLimitKeyEntry.Flag:    "header:X-Api-Key",
+	}, server.WithOutput(&bytes.Buffer{}))
+	assert.Nil(t, err)
+	handleStatus(s, "/", http.StatusCreated)
+	handleStatus(s, "/fail", http.StatusBadGateway)
+	keyA := http.Header{"X-Api-Key": {"a"}}
+	keyB := http.Header{"X-Api-Key": {"b"}}
+
+	// when
+	rootCodes := []int{
+		get(s, "/", "10.0.0.1", keyA),
+		get(s, "/", "10.0.0.2", keyA),
+		get(s, "/", "10.0.0.1", keyB),
+	}
+	failCodes := []int{
+		get(s, "/fail", "10.0.0.1", keyA),
+		get(s, "/fail", "10.0.0.1", keyA),
+		get(s, "/fail", "10.0.0.1", keyA),
+		get(s, "/fail", "10.0.0.1", keyA),
+	}
+
+	// then
+	assert.Equal(t, []int{
+		http.StatusCreated, http.StatusTooManyRequests, http.StatusCreated,
+	}, rootCodes)
+	assert.Equal(t, []int{
+		http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway,
+		http.StatusTooManyRequests,
+	}, failCodes)
+}
+
+func TestRateLimit_withInvalidEntries(t *testing.T) {
+	// given
+	valuesGiven := []map[string]string{
+		{server.RateLimitEntry.Flag: "fast"},
+		{server.RateLimitEntry.Flag: "1:0"},
+		{server.RateLimitRoutesEntry.Flag: "/search"},
+		{server.RateLimitKeyEntry.Flag: "cookie"},
+		{server.TrustedProxiesEntry.Flag: "-1"},
+	}
+
+	for _, values := range valuesGiven {
+		// when
+		_, err := newTestServer(t, config.Development, nil, values)
+
+		// then
+		assert.NotNil(t, err, values)
+	}
+}
+
+func TestRateLimit_withForwardedFor(t *testing.T) {
+	// given
+	s, err := newTestServer(t, config.Development, nil, map[string]string{
+		server.RateLimitEntry.Flag: "1",
+	}, server.WithOutput(&bytes.Buffer{}))
+	assert.Nil(t, err)
+	handleStatus(s, "/", http.StatusCreated)
+
+	// when, the client rotates the addresses it sets before the proxy one
+	codes := []int{
+		get(s, "/", "198.51.100.1, 10.0.0.1", nil),
+		get(s, "/", "198.51.100.2, 10.0.0.1", nil),
+		get(s, "/", "10.0.0.2", nil),
+	}
+
+	// then
+	assert.Equal(t, []int{
+		http.StatusCreated, http.StatusTooManyRequests, http.StatusCreated,
+	}, codes)
+}
+
+func TestRateLimit_withoutTrustedProxies(t *testing.T) {
+	// given
+	s, err := newTestServer(t, config.Development, nil, map[string]string{
+		server.RateLimitEntry.Flag:      "1",
+		server.TrustedProxiesEntry.Flag: "0",
+	}, server.WithOutput(&bytes.Buffer{}))
+	assert.Nil(t, err)
+	handleStatus(s, "/", http.StatusCreated)
+
+	// when, the header is ignored and the peer address is used
+	codes := []int{
+		get(s, "/", "10.0.0.1", nil),
+		get(s, "/", "10.0.0.2", nil),
+	}
+
+	// then
+	assert.Equal(t, []int{
+		http.StatusCreated, http.StatusTooManyRequests,
+	}, codes)
+}
+
+func TestKeyByPrincipal(t *testing.T) {
+	// given
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+
+	// when
+	anonymous := server.KeyByPrincipal(req)
+	authenticated := server.KeyByPrincipal(req.WithContext(
+		server.NewPrincipalContext(req.Context(), "user@example.com")))
+
+	// then, the header is only trusted by the server
+	assert.Equal(t, "192.0.2.1", anonymous)
+	assert.Equal(t, "principal:user@example.com", authenticated)
+}
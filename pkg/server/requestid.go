@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/planetfall/framework/pkg/server/correlation"
+)
+
+// The headers used to correlate the requests.
+const (
+	RequestIDHeader    = "X-Request-Id"
+	TraceIDHeader      = "X-Trace-Id"
+	cloudTraceHeader   = "X-Cloud-Trace-Context"
+	traceParentHeader  = "traceparent"
+	maxRequestIDLength = 128
+)
+
+// RequestID returns the request identifier stored in the context, or an
+// empty string.
+func RequestID(ctx context.Context) string {
+	if ids, ok := correlation.FromContext(ctx); ok {
+		return ids.RequestID
+	}
+
+	return ""
+}
+
+// TraceID returns the trace identifier stored in the context, or an empty
+// string.
+func TraceID(ctx context.Context) string {
+	if ids, ok := correlation.FromContext(ctx); ok {
+		return ids.TraceID
+	}
+
+	return ""
+}
+
+// requestID is the middleware storing the request correlation identifiers
+// into the request context, and echoing them in the response headers.
+// The request identifier is taken from the request header if valid, or
+// generated. The trace is derived from the Cloud Run trace headers.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ids := newCorrelationIDs(req.Header)
+
+		w.Header().Set(RequestIDHeader, ids.RequestID)
+		if ids.TraceID != "" {
+			w.Header().Set(TraceIDHeader, ids.TraceID)
+		}
+
+		ctx := correlation.NewContext(req.Context(), ids)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// newCorrelationIDs creates the correlation identifiers from the request
+// headers. The request identifier is taken from the header if valid, or
+// generated.
+func newCorrelationIDs(header http.Header) correlation.IDs {
+	ids := correlation.IDs{
+		RequestID: header.Get(RequestIDHeader),
+	}
+	if !validRequestID(ids.RequestID) {
+		ids.RequestID = newRequestID()
+	}
+	ids.TraceID, ids.SpanID = parseTrace(header)
+
+	return ids
+}
+
+// newRequestID generates a random request identifier.
+func newRequestID() string {
+	b := make([]byte, 16)
+
+	// crypto/rand never fails on the supported platforms
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID says if a client provided request identifier can be
+// trusted: it must be short and made of printable ASCII characters only.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseTrace extracts the trace and span identifiers from the W3C
+// traceparent header, or from the X-Cloud-Trace-Context header set by Cloud
+// Run.
+func parseTrace(header http.Header) (traceID, spanID string) {
+
+	// traceparent: 00-<trace id>-<span id>-<flags>
+	if parts := strings.Split(header.Get(traceParentHeader), "-"); len(parts) == 4 {
+		if len(parts[1]) == 32 && len(parts[2]) == 16 {
+			return parts[1], parts[2]
+		}
+	}
+
+	// X-Cloud-Trace-Context: <trace id>/<decimal span id>;o=<options>
+	value := header.Get(cloudTraceHeader)
+	value, _, _ = strings.Cut(value, ";")
+	traceID, spanID, _ = strings.Cut(value, "/")
+	if !validRequestID(traceID) {
+		return "", ""
+	}
+
+	if span, err := strconv.ParseUint(spanID, 10, 64); err == nil {
+		return traceID, fmt.Sprintf("%016x", span)
+	}
+
+	return traceID, ""
+}
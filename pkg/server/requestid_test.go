@@ -0,0 +1,108 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// handleIDs registers a handler logging a line and recording the request
+// context identifiers.
+func handleIDs(s *server.Server, requestID, traceID *string) {
+	s.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		*requestID = server.RequestID(r.Context())
+		*traceID = server.TraceID(r.Context())
+		s.StructuredLogger.InfoContext(r.Context(), "handling")
+	})
+}
+
+func TestRequestID_withHeader(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	var requestIDActual, traceIDActual string
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(&output))
+	assert.Nil(t, err)
+	handleIDs(s, &requestIDActual, &traceIDActual)
+	requestIDGiven := "request-id-given"
+
+	// when
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(server.RequestIDHeader, requestIDGiven)
+	req.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	// then
+	assert.Equal(t, requestIDGiven, requestIDActual)
+	assert.Equal(t, "105445aa7843bc8bf206b12000100000", traceIDActual)
+	assert.Equal(t, requestIDGiven, rec.Header().Get(server.RequestIDHeader))
+	assert.Equal(t, traceIDActual, rec.Header().Get(server.TraceIDHeader))
+	assert.Contains(t, output.String(), "requestId="+requestIDGiven)
+	assert.Contains(t, output.String(),
+		"logging.googleapis.com/trace="+traceIDActual)
+	assert.Contains(t, output.String(),
+		"logging.googleapis.com/spanId=0000000000000001")
+}
+
+func TestRequestID_withTraceParent(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	var requestIDActual, traceIDActual string
+	s, err := newTestServer(
+		t, config.Development, nil, nil, server.WithOutput(&output))
+	assert.Nil(t, err)
+	handleIDs(s, &requestIDActual, &traceIDActual)
+
+	// when
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	// then
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceIDActual)
+	assert.Contains(t, output.String(),
+		"logging.googleapis.com/spanId=00f067aa0ba902b7")
+}
+
+func TestRequestID_generated(t *testing.T) {
+	for name, requestIDGiven := range map[string]string{
+		"missing": "",
+		"invalid": "id with spaces",
+	} {
+		t.Run(name, func(t *testing.T) {
+			// given
+			var output bytes.Buffer
+			var requestIDActual, traceIDActual string
+			s, err := newTestServer(
+				t, config.Development, nil, nil, server.WithOutput(&output))
+			assert.Nil(t, err)
+			handleIDs(s, &requestIDActual, &traceIDActual)
+
+			// when
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(server.RequestIDHeader, requestIDGiven)
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+
+			// then
+			assert.Len(t, requestIDActual, 32)
+			assert.Empty(t, traceIDActual)
+			assert.Equal(t, requestIDActual,
+				rec.Header().Get(server.RequestIDHeader))
+			assert.Empty(t, rec.Header().Get(server.TraceIDHeader))
+		})
+	}
+}
+
+func TestRequestID_outsideRequest(t *testing.T) {
+	assert.Empty(t, server.RequestID(context.Background()))
+	assert.Empty(t, server.TraceID(context.Background()))
+}
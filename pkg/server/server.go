@@ -3,100 +3,354 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server/buildinfo"
 	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/planetfall/framework/pkg/server/flags"
+	"github.com/planetfall/framework/pkg/server/metrics"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 )
 
 // Server holds cloud features clients, a logger and the configuration.
 type Server struct {
 	Logger *log.Logger // the logger
 
+	// StructuredLogger is the structured logger. The entries logged with a
+	// request context carry the request and trace identifiers.
+	StructuredLogger *slog.Logger
+
 	cfg config.Config // the configuration
 
 	fp features.FeatureProvider // the provider for cloud features
 
+	mux       *http.ServeMux // the registered handlers
+	routesMu  sync.Mutex     // guards routes
+	routes    []string       // the registered patterns
+	handler   http.Handler   // the handlers wrapped by the middleware
+	accessLog *accessLog     // the requests logger
+
+	grpcOnce    sync.Once           // guards the gRPC server creation
+	grpcServer  *grpc.Server        // the gRPC server, if used
+	grpcOptions []grpc.ServerOption // the custom gRPC server options
+	health      *health.Server      // the gRPC health service
+	multiplexed bool                // serve gRPC along HTTP
+
+	metrics *metrics.Registry // the server metrics
+	workers *workerGroup      // the background workers
+	hooks   hooks             // the lifecycle hooks
+	flags   *flags.Set        // the feature flags, if any
+
+	shutdownTimeout time.Duration  // the maximum time to close
+	version         string         // the service version
+	buildInfo       buildinfo.Info // the build information
+}
+
+// Metrics returns the server metrics registry.
+func (s *Server) Metrics() *metrics.Registry {
+	return s.metrics
+}
+
+// Version returns the service version set using [WithVersion], or read from
+// the build information.
+func (s *Server) Version() string {
+	return s.version
+}
+
+// Flags returns the feature flags set using [WithFlags], or nil.
+func (s *Server) Flags() *flags.Set {
+	return s.flags
+}
+
+// BuildInfo returns the build information of the service, its version being
+// [Server.Version]. It is served on the [VersionPathEntry] path, if set.
+func (s *Server) BuildInfo() buildinfo.Info {
+	info := s.buildInfo
+	info.Version = s.version
+	return info
 }
 
 // Raise logs the error and report it using the ErrorReporting cloud feature.
 // The reporting is only available when in a Clouc environment.
+// The error is logged with the request context, if any.
+//
+// The reported error wraps the given one, so its chain is kept, and carries
+// the stack trace of the caller of Raise, unless the error already carries
+// one, see [features.StackTracer].
 func (s *Server) Raise(message string, err error, req *http.Request) {
-	err = fmt.Errorf("%s: %v", message, err)
-	s.Logger.Println(err)
+	ctx := context.Background()
+	if req != nil {
+		ctx = req.Context()
+	}
+
+	s.raise(ctx, message, err, req)
+}
+
+// raise logs the error with the context and reports it. The request can be
+// nil, such as for the gRPC calls.
+func (s *Server) raise(
+	ctx context.Context, message string, err error, req *http.Request) {
+
+	wrapped := fmt.Errorf("%s: %v", message, err)
+	if err != nil {
+		wrapped = fmt.Errorf("%s: %w", message, err)
+	}
+	err = features.WithStackSkipping(wrapped, frameworkPrefix)
+
+	// the panics stack is logged, as they are not reported locally
+	var args []any
+	var panicErr *panicError
+	if errors.As(err, &panicErr) {
+		args = append(args, "stack", string(panicErr.stack))
+	}
+	s.StructuredLogger.ErrorContext(ctx, err.Error(), args...)
 
 	if s.cfg.Environment().OnCloud() {
-		s.fp.Report(err, req)
+		s.fp.Report(ctx, err, req)
 	}
 }
 
-// Close terminates the server clients. If the server is not running on a
-// Cloud environment, it does nothing and returns nil.
+// Close stops the background workers, gracefully stops the gRPC server, if
+// any, runs the stop hooks and terminates the server clients. If the server
+// is not running on a Cloud environment, the clients are not closed.
+// The server is given a limited time to close, after which an error is
+// returned. The errors of every step are returned together.
 func (s *Server) Close() error {
 
 	s.Logger.Printf("stopping the server")
 
+	ctx, cancel := context.WithTimeout(
+		context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+
+	// the workers may still use the features, they are stopped first
+	if err := s.stopWorkers(ctx); err != nil {
+		s.Logger.Printf("could not stop the workers: %v", err)
+		errs = append(errs, fmt.Errorf("stopWorkers: %v", err))
+	}
+
+	s.stopGRPC(ctx)
+
+	if err := s.runStopHooks(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("runStopHooks: %v", err))
+	}
+
 	if s.cfg.Environment().OnCloud() {
 
 		s.Logger.Printf("stopping onCloud features")
 
-		if err := s.fp.Close(); err != nil {
-			return fmt.Errorf("FeatureProvider.Close: %v", err)
+		if err := s.fp.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("FeatureProvider.Close: %v", err))
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// Lookup returns the started cloud feature of type T, if the server feature
+// provider is backed by a [features.Registry]. T can either be a concrete
+// feature type or an interface.
+func Lookup[T any](s *Server) (T, bool) {
+	return lookup[T](s.fp)
 }
 
-// NewServer creates a new server.
-// It setup a dedicated logger using the serviceName parameter.
-// A custom feature provider can be given. If 0, or more than one is given,
-// it will fallback to the default provider.
-// The default provider includes a metadata client, the error reporting and the
-// secret manager.
+// lookup returns the started feature of type T from the provider registry.
+func lookup[T any](fp features.FeatureProvider) (T, bool) {
+	registryProvider, ok := fp.(features.RegistryProvider)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	return features.Lookup[T](registryProvider.Registry())
+}
+
+// NewServer creates a new server, configured by the options.
+// Unless a logger is given using [WithLogger], it setup a dedicated logger
+// using the serviceName parameter.
+// A custom feature provider can be given using [WithFeatureProvider]. If none
+// is given, it will fallback to the default provider.
+// The default provider includes a metadata client, the error reporting, the
+// secret manager and the Pub/Sub publisher. Features are added to it by
+// registering them into a [features.FeatureProviderImpl] given as the custom
+// provider.
+// The context bounds the features setup: NewServer fails once it is done.
 func NewServer(
+	ctx context.Context,
 	cfg config.Config,
 	serviceName string,
-	featureProvider ...features.FeatureProvider,
+	opts ...Option,
 ) (*Server, error) {
 
-	// setup logging
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("newOptions: %v", err)
+	}
+
+	trustedProxies, err := newTrustedProxies()
+	if err != nil {
+		return nil, fmt.Errorf("newTrustedProxies: %v", err)
+	}
+
+	accessLog, err := newAccessLog()
+	if err != nil {
+		return nil, fmt.Errorf("newAccessLog: %v", err)
+	}
+
+	rateLimits, err := newRouteRateLimits()
+	if err != nil {
+		return nil, fmt.Errorf("newRouteRateLimits: %v", err)
+	}
+
 	environment := cfg.Environment()
-	envPrefix := strings.ToUpper(environment.String())
-	serviceNamePrefix := strings.ToLower(serviceName)
-	logPrefix := fmt.Sprintf("[%s] - %s - ", envPrefix, serviceNamePrefix)
-	logger := log.New(os.Stdout, logPrefix, log.Ldate|log.Ltime)
+	cors, err := newCORS(environment)
+	if err != nil {
+		return nil, fmt.Errorf("newCORS: %v", err)
+	}
+
+	// setup logging
+	logger := o.logger
+	if logger == nil {
+		envPrefix := strings.ToUpper(environment.String())
+		serviceNamePrefix := strings.ToLower(serviceName)
+		logPrefix := fmt.Sprintf("[%s] - %s - ", envPrefix, serviceNamePrefix)
+		logger = log.New(o.output, logPrefix, *o.logFlags)
+	}
 
 	// setup server features
 	logger.Printf("setting up the server for %s", environment)
 
+	buildInfo := buildinfo.Read()
+	version := o.version
+	if version == "" {
+		version = buildInfo.Version
+	}
+	if version != "" {
+		logger.Printf("running version %s", version)
+	}
+
 	var fp features.FeatureProvider
 	if environment.OnCloud() {
 
 		logger.Printf("starting onCloud features")
 
 		fp = new(features.FeatureProviderImpl)
-		if len(featureProvider) == 1 {
-			fp = featureProvider[0]
+		if o.featureProvider != nil {
+			fp = o.featureProvider
+		}
+
+		if setter, ok := fp.(features.ServiceVersionSetter); ok && version != "" {
+			setter.SetServiceVersion(version)
 		}
 
+		// the features that are not required degrade to the local logs until
+		// they start in the background
 		onError := func(err error) {
+			var degradedErr *features.DegradedError
+			if errors.As(err, &degradedErr) {
+				logger.Printf("warning: %v", err)
+				return
+			}
+
 			logger.Printf("could not log error: %v", err)
 		}
-		err := fp.New(serviceName, onError)
-		if err != nil {
+		if err := fp.New(ctx, serviceName, onError); err != nil {
 			return nil, fmt.Errorf("featureProvider.New: %v", err)
 		}
 	}
 
-	return &Server{
-		cfg:    cfg,
-		Logger: logger,
+	// the traces are bound to the project when known
+	projectID := ""
+	if metadataFeature, ok := lookup[*features.MetadataFeature](fp); ok {
+		projectID = metadataFeature.ProjectID
+	}
+	structuredLogger := newStructuredLogger(
+		logger.Writer(), environment, projectID, version)
+
+	accessLog.logger = structuredLogger
+
+	mux := http.NewServeMux()
+	s := &Server{
+		cfg:              cfg,
+		Logger:           logger,
+		StructuredLogger: structuredLogger,
 
 		fp: fp,
-	}, nil
+
+		mux:       mux,
+		accessLog: accessLog,
+
+		grpcOptions: o.grpcOptions,
+		multiplexed: o.multiplexed,
+
+		metrics: metrics.NewRegistry(),
+		workers: newWorkerGroup(),
+
+		shutdownTimeout: o.shutdownTimeout,
+		version:         version,
+		buildInfo:       buildInfo,
+	}
+
+	// the request identifiers and the client address are set before any
+	// other middleware, so the access log entries carry them. The panics are
+	// recovered after the access log, so it logs their 500.
+	middleware := []Middleware{
+		requestID, clientAddress(trustedProxies), accessLog.middleware,
+		s.recoverHandler}
+
+	// the preflight requests are answered before any authentication
+	if cors != nil {
+		middleware = append(middleware, cors.middleware)
+	}
+	middleware = append(middleware, o.middleware...)
+
+	// the rate limits run last, so the principal set by an authentication
+	// middleware is known
+	if rateLimits != nil {
+		middleware = append(middleware, s.rateLimit(rateLimits.limiter))
+	}
+
+	s.handler = chain(mux, middleware...)
+
+	if provider, ok := fp.(features.ReportQueueProvider); ok &&
+		provider.ReportQueue() != nil {
+
+		queue := provider.ReportQueue()
+		s.metrics.Func("report_queue_depth", func() any { return queue.Depth() })
+		s.metrics.Func("report_dropped", func() any { return queue.Dropped() })
+	}
+
+	if o.flags != nil {
+		s.flags = o.flags
+		s.metrics.Func("flag_evaluations", func() any {
+			return o.flags.Evaluations()
+		})
+
+		if viper.ConfigFileUsed() != "" {
+			o.flags.Watch(func(err error) {
+				s.raise(context.Background(), "flags reload", err, nil)
+			})
+		}
+	}
+
+	if path := VersionPathEntry.Value(); path != "" {
+		s.HandleFunc(path, func(w http.ResponseWriter, _ *http.Request) {
+			writeJSON(w, s.BuildInfo())
+		})
+	}
+
+	return s, nil
 }
@@ -1,12 +1,17 @@
 package server_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"testing"
 
 	"github.com/planetfall/framework/pkg/config"
 	"github.com/planetfall/framework/pkg/server"
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -31,7 +36,7 @@ type featureProviderMock struct {
 }
 
 func (m *featureProviderMock) New(
-	serviceName string, onError func(err error)) error {
+	_ context.Context, serviceName string, onError func(err error)) error {
 
 	m.onError = onError
 
@@ -39,17 +44,44 @@ func (m *featureProviderMock) New(
 	return args.Error(0)
 }
 
-func (m *featureProviderMock) Close() error {
+func (m *featureProviderMock) Close(_ context.Context) error {
 	args := m.Called()
 	return args.Error(0)
 }
 
 func (m *featureProviderMock) Report(
-	err error, req *http.Request) {
+	_ context.Context, err error, req *http.Request) {
 
 	m.Called(err)
 }
 
+// newTestServer creates a server for the environment, with the config values
+// set in viper. On a Cloud environment, the server is created with the
+// feature provider mock.
+func newTestServer(
+	t *testing.T, environment config.Environment, fpGiven *featureProviderMock,
+	values map[string]string, opts ...server.Option) (*server.Server, error) {
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+
+	cfgGiven.On(methodEnvironment).Return(environment)
+	if environment.OnCloud() {
+		fpGiven.On("New", serviceGiven).Return(nil)
+		fpGiven.On("Close").Return(nil).Maybe()
+		opts = append([]server.Option{server.WithFeatureProvider(fpGiven)}, opts...)
+	}
+
+	return server.NewServer(
+		context.Background(), cfgGiven, serviceGiven, opts...)
+}
+
 func TestNewServer_withDev(t *testing.T) {
 	// given
 	var cfgGiven = &configMock{}
@@ -57,7 +89,7 @@ func TestNewServer_withDev(t *testing.T) {
 
 	// when
 	cfgGiven.On(methodEnvironment).Return(config.Development)
-	s, err := server.NewServer(cfgGiven, serviceGiven)
+	s, err := server.NewServer(context.Background(), cfgGiven, serviceGiven)
 
 	// then
 	assert.Nil(t, err)
@@ -77,7 +109,8 @@ func TestNewServer_withPrd(t *testing.T) {
 	cfgGiven.On(methodEnvironment).Return(config.Production)
 	fpGiven.On("New", serviceGiven).Return(nil)
 	s, err := server.NewServer(
-		cfgGiven, serviceGiven, fpGiven)
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
 
 	// then
 	assert.Nil(t, err)
@@ -87,6 +120,66 @@ func TestNewServer_withPrd(t *testing.T) {
 	fpGiven.AssertExpectations(t)
 }
 
+func TestNewServer_withPrd_degradedFeature(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+	outputGiven := &bytes.Buffer{}
+
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+	_, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven),
+		server.WithOutput(outputGiven))
+	assert.Nil(t, err)
+
+	// when
+	fpGiven.onError(&features.DegradedError{
+		Feature: features.ErrorReportingName,
+		Err:     fmt.Errorf("unreachable"),
+	})
+
+	// then
+	assert.Contains(t, outputGiven.String(),
+		"warning: feature error-reporting degraded: unreachable")
+}
+
+// feature provider queuing the reports
+type queuedProviderMock struct {
+	*featureProviderMock
+
+	queue *features.ReportQueue
+}
+
+func (m queuedProviderMock) ReportQueue() *features.ReportQueue {
+	return m.queue
+}
+
+func TestNewServer_withPrd_reportQueueMetrics(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+	queueGiven := features.NewReportQueue(fpGiven, 1)
+	t.Cleanup(func() { _ = queueGiven.Close(context.Background()) })
+
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+
+	// when
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(queuedProviderMock{fpGiven, queueGiven}),
+		server.WithOutput(&bytes.Buffer{}))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "0", s.Metrics().Get("report_queue_depth").String())
+	assert.Equal(t, "0", s.Metrics().Get("report_dropped").String())
+}
+
 func TestNewServer_withPrd_shouldFail(t *testing.T) {
 	// given
 	var cfgGiven = &configMock{}
@@ -98,7 +191,8 @@ func TestNewServer_withPrd_shouldFail(t *testing.T) {
 	cfgGiven.On(methodEnvironment).Return(config.Production)
 	fpGiven.On("New", serviceGiven).Return(errorGiven)
 	s, err := server.NewServer(
-		cfgGiven, serviceGiven, fpGiven)
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
 
 	// then
 	assert.NotNil(t, err)
@@ -109,6 +203,28 @@ func TestNewServer_withPrd_shouldFail(t *testing.T) {
 	fpGiven.AssertExpectations(t)
 }
 
+func TestLookup_withoutRegistry(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+
+	// when
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
+	assert.Nil(t, err)
+
+	_, ok := server.Lookup[*features.MetadataFeature](s)
+
+	// then
+	assert.False(t, ok)
+	cfgGiven.AssertExpectations(t)
+	fpGiven.AssertExpectations(t)
+}
+
 func TestRaise_withDev(t *testing.T) {
 	// given
 	var cfgGiven = &configMock{}
@@ -119,7 +235,7 @@ func TestRaise_withDev(t *testing.T) {
 
 	// when
 	cfgGiven.On(methodEnvironment).Return(config.Development)
-	s, err := server.NewServer(cfgGiven, serviceGiven)
+	s, err := server.NewServer(context.Background(), cfgGiven, serviceGiven)
 	assert.Nil(t, err)
 	assert.NotNil(t, s)
 
@@ -143,7 +259,8 @@ func TestRaise_withPrd(t *testing.T) {
 	fpGiven.On("New", serviceGiven).Return(nil)
 	fpGiven.On("Report", mock.Anything).Return()
 	s, err := server.NewServer(
-		cfgGiven, serviceGiven, fpGiven)
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
 
 	assert.Nil(t, err)
 	assert.NotNil(t, s)
@@ -155,6 +272,76 @@ func TestRaise_withPrd(t *testing.T) {
 	cfgGiven.AssertExpectations(t)
 }
 
+func TestRaise_withPrd_shouldKeepChainAndStack(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+	errorGiven := fmt.Errorf("test error")
+
+	var reported error
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+	fpGiven.On("Report", mock.Anything).Run(func(args mock.Arguments) {
+		reported = args.Error(0)
+	}).Return()
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven),
+		server.WithOutput(&bytes.Buffer{}))
+	assert.Nil(t, err)
+
+	// when
+	s.Raise("test error message", errorGiven, nil)
+
+	var tracer features.StackTracer
+	ok := errors.As(reported, &tracer)
+
+	// then
+	assert.ErrorIs(t, reported, errorGiven)
+	assert.Equal(t, "test error message: test error", reported.Error())
+	assert.True(t, ok)
+	assert.Regexp(t,
+		`^goroutine \d+ \[running\]:\n\S+/server_test\.TestRaise_withPrd_shouldKeepChainAndStack\(\.\.\.\)\n`,
+		string(tracer.StackTrace()))
+}
+
+func TestRaise_withPrd_shouldKeepErrorStack(t *testing.T) {
+	// given
+	var cfgGiven = &configMock{}
+	serviceGiven := "service-name"
+	fpGiven := &featureProviderMock{}
+	errorGiven := failWithStack()
+
+	var reported error
+	cfgGiven.On(methodEnvironment).Return(config.Production)
+	fpGiven.On("New", serviceGiven).Return(nil)
+	fpGiven.On("Report", mock.Anything).Run(func(args mock.Arguments) {
+		reported = args.Error(0)
+	}).Return()
+	s, err := server.NewServer(
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven),
+		server.WithOutput(&bytes.Buffer{}))
+	assert.Nil(t, err)
+
+	// when
+	s.Raise("test error message", errorGiven, nil)
+
+	var tracer features.StackTracer
+	ok := errors.As(reported, &tracer)
+
+	// then
+	assert.True(t, ok)
+	assert.Regexp(t,
+		`^goroutine \d+ \[running\]:\n\S+/server_test\.failWithStack\(\.\.\.\)\n`,
+		string(tracer.StackTrace()))
+}
+
+func failWithStack() error {
+	return features.WithStack(fmt.Errorf("failed deep down"))
+}
+
 func TestRaise_withDevAndErrorNil(t *testing.T) {
 	// given
 	var cfgGiven = &configMock{}
@@ -164,7 +351,7 @@ func TestRaise_withDevAndErrorNil(t *testing.T) {
 
 	// when
 	cfgGiven.On(methodEnvironment).Return(config.Development)
-	s, err := server.NewServer(cfgGiven, serviceGiven)
+	s, err := server.NewServer(context.Background(), cfgGiven, serviceGiven)
 	assert.Nil(t, err)
 	assert.NotNil(t, s)
 
@@ -181,7 +368,7 @@ func TestClose_withDev(t *testing.T) {
 
 	// when
 	cfgGiven.On(methodEnvironment).Return(config.Development)
-	s, err := server.NewServer(cfgGiven, serviceGiven)
+	s, err := server.NewServer(context.Background(), cfgGiven, serviceGiven)
 	assert.Nil(t, err)
 	assert.NotNil(t, s)
 
@@ -203,7 +390,8 @@ func TestClose_withPrd(t *testing.T) {
 	fpGiven.On("New", serviceGiven).Return(nil)
 	fpGiven.On("Close").Return(nil)
 	s, err := server.NewServer(
-		cfgGiven, serviceGiven, fpGiven)
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
 
 	assert.Nil(t, err)
 	assert.NotNil(t, s)
@@ -228,7 +416,8 @@ func TestClose_withPrd_shouldFail(t *testing.T) {
 	fpGiven.On("New", serviceGiven).Return(nil)
 	fpGiven.On("Close").Return(errorGiven)
 	s, err := server.NewServer(
-		cfgGiven, serviceGiven, fpGiven)
+		context.Background(), cfgGiven, serviceGiven,
+		server.WithFeatureProvider(fpGiven))
 
 	assert.Nil(t, err)
 	assert.NotNil(t, s)
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/planetfall/framework/pkg/server/features"
+)
+
+// TaskInfo describes a Cloud Tasks request, read from its headers.
+type TaskInfo struct {
+	Queue            string    // the queue name
+	Name             string    // the task short name
+	RetryCount       int       // the times the task was retried
+	ExecutionCount   int       // the times the task got a response
+	ETA              time.Time // the time the task was scheduled for
+	PreviousResponse int       // the status code of the previous attempt
+}
+
+// taskKey is the context key of the task information.
+type taskKey struct{}
+
+// TaskFromContext returns the information of the task being handled.
+func TaskFromContext(ctx context.Context) (TaskInfo, bool) {
+	info, ok := ctx.Value(taskKey{}).(TaskInfo)
+	return info, ok
+}
+
+// TaskHandler processes a Cloud Tasks request. The task information is found
+// in the request context with [TaskFromContext].
+//
+// Returning nil completes the task. Returning an [*Error] with a client kind,
+// such as [InvalidArgument], marks the task as poison: it is raised and
+// completed as retrying would fail again. Any other error makes the task
+// retried.
+type TaskHandler func(w http.ResponseWriter, req *http.Request) error
+
+// TaskConfig configures a Cloud Tasks endpoint.
+type TaskConfig struct {
+	// OIDC configures the verification of the task authentication token.
+	OIDC OIDCConfig
+	// MaxAttempts is the number of attempts after which a failing task is
+	// raised, typically the queue max attempts. The failures are only logged
+	// before. Every failure is raised when 0.
+	MaxAttempts int
+}
+
+// HandleTask registers a Cloud Tasks endpoint for the given pattern.
+// The task token is verified, the X-CloudTasks headers read into the context
+// and the handler error mapped to a status code driving the retries.
+// It fails on a Cloud environment if the OIDC service account is not set.
+func (s *Server) HandleTask(
+	pattern string, handler TaskHandler, cfg TaskConfig) error {
+
+	if err := s.checkOIDC(cfg.OIDC); err != nil {
+		return fmt.Errorf("checkOIDC: %v", err)
+	}
+
+	s.Handle(pattern, s.Handler(func(w http.ResponseWriter, req *http.Request) error {
+		if err := s.verifyOIDC(req, cfg.OIDC); err != nil {
+			return err
+		}
+
+		info, err := newTaskInfo(req.Header)
+		if err != nil {
+			return InvalidArgument("invalid task headers", err)
+		}
+
+		req = req.WithContext(context.WithValue(req.Context(), taskKey{}, info))
+
+		rw := newResponseWriter(w)
+		err = handler(rw, req)
+		if err == nil {
+			if !rw.wroteHeader {
+				rw.WriteHeader(http.StatusNoContent)
+			}
+			return nil
+		}
+
+		message := fmt.Sprintf("task %s/%s", info.Queue, info.Name)
+
+		// poison tasks are completed, retrying them is pointless
+		var appErr *Error
+		if errors.As(err, &appErr) &&
+			appErr.Kind.Status() < http.StatusInternalServerError {
+
+			s.Raise("poison "+message, err, req)
+			rw.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		if cfg.MaxAttempts == 0 || info.RetryCount+1 >= cfg.MaxAttempts {
+			return err
+		}
+
+		// the failure is only logged, the task is retried
+		s.StructuredLogger.WarnContext(req.Context(),
+			fmt.Sprintf("%s failed: %v", message, err),
+			"retryCount", info.RetryCount)
+		writeProblem(rw, req, http.StatusServiceUnavailable, "")
+		return nil
+	}))
+
+	return nil
+}
+
+// newTaskInfo reads the task information from the X-CloudTasks headers.
+func newTaskInfo(header http.Header) (TaskInfo, error) {
+	info := TaskInfo{
+		Queue: header.Get(features.TaskQueueHeader),
+		Name:  header.Get(features.TaskNameHeader),
+	}
+
+	for key, dest := range map[string]*int{
+		features.TaskRetryCountHeader:       &info.RetryCount,
+		features.TaskExecutionCountHeader:   &info.ExecutionCount,
+		features.TaskPreviousResponseHeader: &info.PreviousResponse,
+	} {
+		value := header.Get(key)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return info, fmt.Errorf("%s: %v", key, err)
+		}
+		*dest = n
+	}
+
+	if eta := header.Get(features.TaskETAHeader); eta != "" {
+		seconds, err := strconv.ParseFloat(eta, 64)
+		if err != nil {
+			return info, fmt.Errorf("%s: %v", features.TaskETAHeader, err)
+		}
+		info.ETA = time.Unix(0, int64(seconds*float64(time.Second)))
+	}
+
+	return info, nil
+}
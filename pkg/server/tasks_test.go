@@ -0,0 +1,163 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// handleTask registers a task endpoint calling the handler.
+func handleTask(t *testing.T, s *server.Server, handler server.TaskHandler) {
+	err := s.HandleTask("/tasks/cleanup", handler, server.TaskConfig{
+		OIDC: server.OIDCConfig{
+			ServiceAccount: "tasks@project.iam.gserviceaccount.com",
+			Validator:      validatorStub("tasks@project.iam.gserviceaccount.com"),
+		},
+		MaxAttempts: 5,
+	})
+	assert.Nil(t, err)
+}
+
+// runTask sends a task request with the token and retry count.
+func runTask(
+	s *server.Server, token, retryCount string) *httptest.ResponseRecorder {
+
+	req := httptest.NewRequest(http.MethodPost, "/tasks/cleanup", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set(features.TaskQueueHeader, "queue")
+	req.Header.Set(features.TaskNameHeader, "task")
+	req.Header.Set(features.TaskRetryCountHeader, retryCount)
+	req.Header.Set(features.TaskETAHeader, "1696154400.5")
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleTask(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	var infoActual server.TaskInfo
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleTask(t, s,
+		func(w http.ResponseWriter, req *http.Request) error {
+			infoActual, _ = server.TaskFromContext(req.Context())
+			return nil
+		})
+
+	// when
+	rec := runTask(s, "valid", "2")
+
+	// then
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "queue", infoActual.Queue)
+	assert.Equal(t, "task", infoActual.Name)
+	assert.Equal(t, 2, infoActual.RetryCount)
+	assert.Equal(t, int64(1696154400), infoActual.ETA.Unix())
+	fpGiven.AssertExpectations(t)
+}
+
+func TestHandleTask_withInvalidToken(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleTask(t, s,
+		func(w http.ResponseWriter, req *http.Request) error {
+			return nil
+		})
+
+	// when
+	rec := runTask(s, "invalid", "0")
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestHandleTask_withoutServiceAccount_shouldFail(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleTask(t, s,
+		func(w http.ResponseWriter, req *http.Request) error {
+			return nil
+		})
+
+	// when
+	err = s.HandleTask("/tasks/other",
+		func(w http.ResponseWriter, req *http.Request) error {
+			return nil
+		}, server.TaskConfig{})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "service account")
+}
+
+func TestHandleTask_withPoisonTask(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	fpGiven.On("Report", mock.Anything).Return()
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleTask(t, s,
+		func(w http.ResponseWriter, req *http.Request) error {
+			return server.InvalidArgument("unexpected payload", nil)
+		})
+
+	// when
+	rec := runTask(s, "valid", "0")
+
+	// then
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	fpGiven.AssertExpectations(t)
+}
+
+func TestHandleTask_withTransientError(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleTask(t, s,
+		func(w http.ResponseWriter, req *http.Request) error {
+			return fmt.Errorf("database unavailable")
+		})
+
+	// when
+	rec := runTask(s, "valid", "0")
+
+	// then
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestHandleTask_withLastAttempt(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	fpGiven.On("Report", mock.Anything).Return()
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	handleTask(t, s,
+		func(w http.ResponseWriter, req *http.Request) error {
+			return fmt.Errorf("database unavailable")
+		})
+
+	// when
+	rec := runTask(s, "valid", "4")
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	fpGiven.AssertExpectations(t)
+}
@@ -0,0 +1,53 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/planetfall/framework/pkg/server/buildinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_version(t *testing.T) {
+	// given
+	s, err := newTestServer(t, config.Development, nil, nil,
+		server.WithOutput(&bytes.Buffer{}), server.WithVersion("v1.2.3"))
+	assert.Nil(t, err)
+
+	// when
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var info buildinfo.Info
+	errDecode := json.Unmarshal(rec.Body.Bytes(), &info)
+
+	// then
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Nil(t, errDecode)
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, s.BuildInfo(), info)
+}
+
+func TestServer_versionDisabled(t *testing.T) {
+	// given
+	s, err := newTestServer(t, config.Development, nil, map[string]string{
+		server.VersionPathEntry.Flag: "",
+	}, server.WithOutput(&bytes.Buffer{}), server.WithVersion("v1.2.3"))
+	assert.Nil(t, err)
+
+	// when, the service can use the path
+	s.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	// then
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
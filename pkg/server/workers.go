@@ -0,0 +1,265 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The default backoff between two runs of a failing worker.
+const (
+	defaultWorkerMinBackoff = time.Second
+	defaultWorkerMaxBackoff = time.Minute
+)
+
+// RestartPolicy says when a background worker is run again.
+type RestartPolicy int
+
+// The restart policies.
+const (
+	// RestartOnFailure runs the worker again when it fails or panics. The
+	// worker is done once it returns nil.
+	RestartOnFailure RestartPolicy = iota
+	// RestartAlways runs the worker again whenever it returns.
+	RestartAlways
+	// RestartNever runs the worker once.
+	RestartNever
+)
+
+// WorkerOption configures a background worker started by [Server.Go].
+type WorkerOption func(w *worker)
+
+// WithRestart sets the restart policy of the worker. It defaults to
+// [RestartOnFailure].
+func WithRestart(policy RestartPolicy) WorkerOption {
+	return func(w *worker) {
+		w.policy = policy
+	}
+}
+
+// WithBackoff sets the pause before restarting a failing worker. It starts
+// at min and doubles after each consecutive failure, up to max. It defaults
+// to one second and one minute.
+func WithBackoff(min, max time.Duration) WorkerOption {
+	return func(w *worker) {
+		w.minBackoff = min
+		w.maxBackoff = max
+	}
+}
+
+// worker is a supervised background worker.
+type worker struct {
+	name       string                          // the worker name
+	fn         func(ctx context.Context) error // the worker function
+	policy     RestartPolicy                   // when the worker is run again
+	minBackoff time.Duration                   // the first restart pause
+	maxBackoff time.Duration                   // the maximum restart pause
+
+	mu  sync.Mutex // guards err
+	err error      // the last failure, nil while the worker runs fine
+}
+
+// setErr records the last failure of the worker.
+func (w *worker) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.err = err
+}
+
+// lastErr returns the last failure of the worker.
+func (w *worker) lastErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// workerGroup holds the background workers of a server.
+type workerGroup struct {
+	ctx    context.Context    // the workers context, done on close
+	cancel context.CancelFunc // cancels the workers context
+	wg     sync.WaitGroup     // the running workers
+
+	mu      sync.Mutex         // guards workers
+	workers map[string]*worker // the workers by name
+}
+
+// newWorkerGroup creates an empty worker group.
+func newWorkerGroup() *workerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workerGroup{
+		ctx:     ctx,
+		cancel:  cancel,
+		workers: make(map[string]*worker),
+	}
+}
+
+// Go runs fn in the background until the server is closed. The context given
+// to fn is done once [Server.Close] is called, and Close waits for the
+// workers to return within the shutdown timeout.
+//
+// The worker is supervised: its errors and panics are raised, and it is run
+// again according to its restart policy, with an exponential backoff. A
+// failing worker makes the server not ready, see [Server.Ready].
+//
+// It panics if a worker with the same name was already started.
+func (s *Server) Go(
+	name string, fn func(ctx context.Context) error, opts ...WorkerOption) {
+
+	w := &worker{
+		name:       name,
+		fn:         fn,
+		policy:     RestartOnFailure,
+		minBackoff: defaultWorkerMinBackoff,
+		maxBackoff: defaultWorkerMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	s.workers.mu.Lock()
+	if _, exists := s.workers.workers[name]; exists {
+		s.workers.mu.Unlock()
+		panic(fmt.Sprintf("server: worker %s already started", name))
+	}
+	s.workers.workers[name] = w
+	s.workers.mu.Unlock()
+
+	s.workers.wg.Add(1)
+	go func() {
+		defer s.workers.wg.Done()
+		s.supervise(s.workers.ctx, w)
+	}()
+}
+
+// supervise runs the worker until it is done or the context is done.
+func (s *Server) supervise(ctx context.Context, w *worker) {
+	backoff := w.minBackoff
+	for {
+		start := time.Now()
+		err := runWorker(ctx, w)
+
+		// the errors caused by the shutdown are expected
+		if ctx.Err() != nil {
+			w.setErr(nil)
+			return
+		}
+
+		if err == nil {
+			if w.policy != RestartAlways {
+				s.Logger.Printf("worker %s done", w.name)
+				return
+			}
+		} else {
+			s.raise(ctx, "worker "+w.name, err, nil)
+			s.metrics.Map("worker_failures").Add(w.name, 1)
+
+			w.setErr(err)
+			if w.policy == RestartNever {
+				return
+			}
+		}
+
+		// a worker running longer than the backoff is considered recovered
+		if time.Since(start) > w.maxBackoff {
+			backoff = w.minBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			w.setErr(nil)
+			return
+		case <-time.After(backoff):
+		}
+
+		// the restarted worker is running again
+		w.setErr(nil)
+		s.metrics.Map("worker_restarts").Add(w.name, 1)
+		if err != nil {
+			backoff = min(2*backoff, w.maxBackoff)
+		}
+	}
+}
+
+// runWorker runs the worker function once, turning a panic into an error.
+// The stack of an error without one is topped with the worker function, as
+// the supervisor stack only has framework frames.
+func runWorker(ctx context.Context, w *worker) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = newPanicError(recovered)
+		}
+	}()
+
+	if err := w.fn(ctx); err != nil {
+		return withFuncStack(err, w.fn)
+	}
+
+	return nil
+}
+
+// Ready returns an error naming the background workers that failed and are
+// waiting to be restarted, or that failed for good. It returns nil when every
+// worker is running or done.
+func (s *Server) Ready() error {
+	s.workers.mu.Lock()
+	workers := make([]*worker, 0, len(s.workers.workers))
+	for _, w := range s.workers.workers {
+		workers = append(workers, w)
+	}
+	s.workers.mu.Unlock()
+
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].name < workers[j].name
+	})
+
+	var errs []error
+	for _, w := range workers {
+		if err := w.lastErr(); err != nil {
+			errs = append(errs, fmt.Errorf("worker %s: %v", w.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ReadyHandler returns a readiness check handler, answering 204 when the
+// server is ready and a 503 problem otherwise. See [Server.Ready]. The
+// workers errors are logged, and not exposed in the response.
+func (s *Server) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := s.Ready(); err != nil {
+			s.StructuredLogger.WarnContext(req.Context(),
+				fmt.Sprintf("not ready: %v", err))
+			writeProblem(w, req, http.StatusServiceUnavailable,
+				"the server is not ready")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// stopWorkers cancels the workers and waits for them to return, until the
+// context is done.
+func (s *Server) stopWorkers(ctx context.Context) error {
+	s.workers.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.workers.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers did not stop: %v", ctx.Err())
+	}
+}
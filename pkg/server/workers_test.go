@@ -0,0 +1,170 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/planetfall/framework/pkg/config"
+	"github.com/planetfall/framework/pkg/server"
+	"github.com/planetfall/framework/pkg/server/features"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGo_shouldStopOnClose(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	started := make(chan struct{})
+	var stopped atomic.Bool
+
+	// when
+	s.Go("poller", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		stopped.Store(true)
+		return ctx.Err()
+	})
+	<-started
+	err = s.Close()
+
+	// then
+	assert.Nil(t, err)
+	assert.True(t, stopped.Load())
+	fpGiven.AssertNotCalled(t, "Report", mock.Anything)
+}
+
+func TestGo_shouldRestartOnFailure(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	fpGiven.On("Report", mock.Anything).Return()
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	var runs atomic.Int32
+	done := make(chan struct{})
+
+	// when
+	s.Go("consumer", func(ctx context.Context) error {
+		switch runs.Add(1) {
+		case 1:
+			return fmt.Errorf("connection lost")
+		case 2:
+			panic("unexpected message")
+		default:
+			close(done)
+			return nil
+		}
+	}, server.WithBackoff(time.Millisecond, 10*time.Millisecond))
+	<-done
+
+	// then
+	assert.Eventually(t, func() bool { return s.Ready() == nil },
+		time.Second, time.Millisecond)
+	assert.Equal(t, int32(3), runs.Load())
+	fpGiven.AssertNumberOfCalls(t, "Report", 2)
+	assert.Equal(t, `{"consumer": 2}`,
+		s.Metrics().Get("worker_restarts").String())
+	assert.Nil(t, s.Close())
+}
+
+func TestGo_withRestartNever(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	fpGiven.On("Report", mock.Anything).Return()
+	var output bytes.Buffer
+	s, err := newTestServer(
+		t, config.Production, fpGiven, nil, server.WithOutput(&output))
+	assert.Nil(t, err)
+	s.HandleFunc("/ready", s.ReadyHandler().ServeHTTP)
+
+	// when
+	s.Go("migration", func(ctx context.Context) error {
+		return fmt.Errorf("schema conflict")
+	}, server.WithRestart(server.RestartNever))
+
+	// then
+	assert.Eventually(t, func() bool { return s.Ready() != nil },
+		time.Second, time.Millisecond)
+	assert.Contains(t, s.Ready().Error(), "worker migration: schema conflict")
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "schema conflict")
+	assert.Contains(t, output.String(), "not ready: worker migration: schema conflict")
+	assert.Nil(t, s.Close())
+}
+
+func TestGo_withUntypedError_shouldCarryWorkerStack(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	reported := make(chan error, 1)
+	fpGiven.On("Report", mock.Anything).Run(func(args mock.Arguments) {
+		reported <- args.Error(0)
+	}).Return()
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+
+	// when
+	s.Go("migration", func(ctx context.Context) error {
+		return fmt.Errorf("schema conflict")
+	}, server.WithRestart(server.RestartNever))
+
+	var tracer features.StackTracer
+	ok := errors.As(<-reported, &tracer)
+
+	// then
+	assert.True(t, ok)
+	assert.Regexp(t,
+		`^goroutine \d+ \[running\]:\n\S+/server_test\.TestGo_withUntypedError_shouldCarryWorkerStack\.func\d+\(\.\.\.\)\n\t\S+/workers_test\.go:\d+ \+0x0\n`,
+		string(tracer.StackTrace()))
+	assert.Nil(t, s.Close())
+}
+
+func TestGo_withDuplicateName(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil)
+	assert.Nil(t, err)
+	worker := func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}
+	s.Go("poller", worker)
+
+	// when
+	// then
+	assert.Panics(t, func() { s.Go("poller", worker) })
+	assert.Nil(t, s.Close())
+}
+
+func TestClose_withStuckWorker(t *testing.T) {
+	// given
+	fpGiven := &featureProviderMock{}
+	s, err := newTestServer(t, config.Production, fpGiven, nil,
+		server.WithShutdownTimeout(10*time.Millisecond))
+	assert.Nil(t, err)
+	release := make(chan struct{})
+	defer close(release)
+
+	s.Go("stuck", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	// when
+	err = s.Close()
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "workers did not stop")
+	fpGiven.AssertExpectations(t)
+}